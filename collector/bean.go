@@ -0,0 +1,373 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"hadoop_jmx_exporter/jmx"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var parseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "hadoop_jmx_parse_errors_total",
+	Help: "Total number of JMX attributes that were missing or had an unexpected type",
+}, []string{"bean", "attribute"})
+
+func init() {
+	prometheus.MustRegister(parseErrors)
+}
+
+// errMissing is returned for an attribute the bean does not have, often one of a newer hadoop version
+var errMissing = errors.New("missing")
+
+// Bean is one entry of the beans array returned by /jmx, e.g.
+// {"name":"Hadoop:service=NameNode,name=FSNamesystem", "modelerType":"FSNamesystem", "MissingBlocks":0, ...}
+// attributes are kept as raw json and only decoded when a collector reads them, most of a NameNode
+// response is LiveNodes and similar strings that are never exported
+type Bean struct {
+	name  string
+	attrs map[string]rawValue
+	// name parsed when the bean is decoded, valid is false when it does not parse
+	objectName jmx.ObjectName
+	valid      bool
+	// type errors of the index the bean belongs to
+	errs *atomic.Int64
+}
+
+// BeanIndex holds the beans of one /jmx response, decoded once per scrape and shared by the
+// collector detection and the collectors
+type BeanIndex struct {
+	beans  []Bean
+	byName map[string]int
+	// attributes the collectors found with an unexpected type, see TypeErrors
+	errs atomic.Int64
+}
+
+// decodeBeans decodes a /jmx response, it fails when the body is not a JMX json document, for
+// example the html login page of a secured cluster. The attributes point into data, which must not
+// be changed afterwards
+func decodeBeans(data []byte) (*BeanIndex, error) {
+	idx, err := decodeBeanList(data)
+	if err != nil {
+		parseErrors.WithLabelValues("", "").Inc()
+		return nil, fmt.Errorf("error json Unmarshal: %v", err)
+	}
+	if idx == nil {
+		parseErrors.WithLabelValues("", "beans").Inc()
+		return nil, fmt.Errorf("no beans in jmx response")
+	}
+	return idx, nil
+}
+
+// rawValue is an attribute of a bean, unlike json.RawMessage it is not copied but points into the
+// response, json.Unmarshal passes UnmarshalJSON a slice of its input
+type rawValue []byte
+
+func (r *rawValue) UnmarshalJSON(data []byte) error {
+	*r = data
+	return nil
+}
+
+// decodeBeanList reads {"beans":[...]}, other top level keys are skipped, the index is nil without
+// a beans key
+func decodeBeanList(data []byte) (*BeanIndex, error) {
+	var response struct {
+		Beans []map[string]rawValue `json:"beans"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	if response.Beans == nil {
+		return nil, nil
+	}
+
+	idx := &BeanIndex{beans: make([]Bean, 0, len(response.Beans)), byName: make(map[string]int, len(response.Beans))}
+	for _, attrs := range response.Beans {
+		idx.add(attrs)
+	}
+	return idx, nil
+}
+
+func (idx *BeanIndex) add(attrs map[string]rawValue) {
+	var name string
+	if raw, ok := attrs["name"]; ok {
+		json.Unmarshal(raw, &name)
+	}
+
+	bean := Bean{name: name, attrs: attrs, errs: &idx.errs}
+	bean.objectName, bean.valid = parseBeanName(name)
+	idx.byName[bean.canonicalName()] = len(idx.beans)
+	idx.beans = append(idx.beans, bean)
+}
+
+// merge adds the beans of other that idx does not have yet
+func (idx *BeanIndex) merge(other *BeanIndex) {
+	for _, bean := range other.beans {
+		key := bean.canonicalName()
+		if _, ok := idx.byName[key]; ok {
+			continue
+		}
+		bean.errs = &idx.errs
+		idx.byName[key] = len(idx.beans)
+		idx.beans = append(idx.beans, bean)
+	}
+}
+
+// Beans returns all beans in the order of the response
+func (idx *BeanIndex) Beans() []Bean {
+	return idx.beans
+}
+
+// TypeErrors returns how many attributes the collectors found with an unexpected type so far, the
+// collectors run one after another so the difference before and after one is its own errors
+func (idx *BeanIndex) TypeErrors() int64 {
+	return idx.errs.Load()
+}
+
+// Get returns the bean with the given ObjectName, the order of the key properties does not matter
+func (idx *BeanIndex) Get(name string) (Bean, bool) {
+	i, ok := idx.byName[canonicalName(name)]
+	if !ok {
+		return Bean{}, false
+	}
+	return idx.beans[i], true
+}
+
+// Match returns the beans whose ObjectName matches pattern, see jmx.ParseObjectNamePattern
+func (idx *BeanIndex) Match(pattern jmx.ObjectName) []Bean {
+	var beans []Bean
+	for _, bean := range idx.beans {
+		if bean.valid && bean.objectName.Match(pattern) {
+			beans = append(beans, bean)
+		}
+	}
+	return beans
+}
+
+// Name returns the ObjectName of the bean, empty if it has none
+func (b Bean) Name() string {
+	return b.name
+}
+
+// ObjectName returns the parsed name of the bean, ok is false when the name is no ObjectName
+func (b Bean) ObjectName() (jmx.ObjectName, bool) {
+	return b.objectName, b.valid
+}
+
+func (b Bean) canonicalName() string {
+	if !b.valid {
+		return b.name
+	}
+	return b.objectName.String()
+}
+
+// ModelerType returns the modelerType of the bean, empty if it has none
+func (b Bean) ModelerType() string {
+	modelerType, _ := b.String("modelerType")
+	return modelerType
+}
+
+// raw returns attr of b, a json null counts as missing
+func (b Bean) raw(attr string) (rawValue, error) {
+	raw, ok := b.attrs[attr]
+	if !ok || string(raw) == "null" || len(raw) == 0 {
+		return nil, fmt.Errorf("attribute %s of %s is %w", attr, b.name, errMissing)
+	}
+	return raw, nil
+}
+
+// jsonType names the json type of raw for error messages
+func jsonType(raw rawValue) string {
+	switch raw[0] {
+	case '"':
+		return "a string"
+	case '{':
+		return "an object"
+	case '[':
+		return "an array"
+	case 't', 'f':
+		return "a boolean"
+	}
+	return "a number"
+}
+
+// Float returns a numeric attribute
+func (b Bean) Float(attr string) (float64, error) {
+	raw, err := b.raw(attr)
+	if err != nil {
+		return 0, err
+	}
+	if jsonType(raw) != "a number" {
+		return 0, fmt.Errorf("attribute %s of %s is %s, not a number", attr, b.name, jsonType(raw))
+	}
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return 0, fmt.Errorf("attribute %s of %s: %v", attr, b.name, err)
+	}
+	return f, nil
+}
+
+// String returns a string attribute
+func (b Bean) String(attr string) (string, error) {
+	raw, err := b.raw(attr)
+	if err != nil {
+		return "", err
+	}
+	if jsonType(raw) != "a string" {
+		return "", fmt.Errorf("attribute %s of %s is %s, not a string", attr, b.name, jsonType(raw))
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("attribute %s of %s: %v", attr, b.name, err)
+	}
+	return s, nil
+}
+
+// Map returns a composite attribute like HeapMemoryUsage, the result keeps the name of b
+// so errors still point at the right bean
+func (b Bean) Map(attr string) (Bean, error) {
+	raw, err := b.raw(attr)
+	if err != nil {
+		return Bean{}, err
+	}
+	if jsonType(raw) != "an object" {
+		return Bean{}, fmt.Errorf("attribute %s of %s is %s, not an object", attr, b.name, jsonType(raw))
+	}
+	var attrs map[string]rawValue
+	if err := json.Unmarshal(raw, &attrs); err != nil {
+		return Bean{}, fmt.Errorf("attribute %s of %s: %v", attr, b.name, err)
+	}
+	return Bean{name: b.name, attrs: attrs, objectName: b.objectName, valid: b.valid, errs: b.errs}, nil
+}
+
+// Attribute is a numeric attribute of a bean, see Bean.Numbers
+type Attribute struct {
+	Name  string
+	Value float64
+}
+
+// Numbers returns the numeric and boolean attributes of b sorted by name, booleans are 1 or 0 and the
+// fields of composite values are named like HeapMemoryUsage.used, nothing is counted as a parse error
+func (b Bean) Numbers() []Attribute {
+	names := make([]string, 0, len(b.attrs))
+	for name := range b.attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var attrs []Attribute
+	for _, name := range names {
+		raw := b.attrs[name]
+		if len(raw) == 0 {
+			continue
+		}
+		if raw[0] == '{' {
+			if sub, err := b.Map(name); err == nil {
+				for _, attr := range sub.Numbers() {
+					// one level is enough for MemoryUsage and friends
+					if !strings.Contains(attr.Name, ".") {
+						attrs = append(attrs, Attribute{Name: name + "." + attr.Name, Value: attr.Value})
+					}
+				}
+			}
+			continue
+		}
+		if v, ok := rawNumber(raw); ok {
+			attrs = append(attrs, Attribute{Name: name, Value: v})
+		}
+	}
+	return attrs
+}
+
+// rawNumber returns the value of a json number or boolean
+func rawNumber(raw rawValue) (float64, bool) {
+	switch string(raw) {
+	case "true":
+		return 1, true
+	case "false":
+		return 0, true
+	}
+	if jsonType(raw) != "a number" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(raw), 64)
+	return f, err == nil
+}
+
+// float is Float for collectors, a problem is counted and ok is false so the caller
+// skips only this metric
+func (b Bean) float(attr string) (float64, bool) {
+	f, err := b.Float(attr)
+	if err != nil {
+		b.parseError(attr, err)
+		return 0, false
+	}
+	return f, true
+}
+
+// string is String for collectors, see float
+func (b Bean) string(attr string) (string, bool) {
+	s, err := b.String(attr)
+	if err != nil {
+		b.parseError(attr, err)
+		return "", false
+	}
+	return s, true
+}
+
+// object is Map for collectors, see float
+func (b Bean) object(attr string) (Bean, bool) {
+	m, err := b.Map(attr)
+	if err != nil {
+		b.parseError(attr, err)
+		return Bean{}, false
+	}
+	return m, true
+}
+
+// parseError only counts, a missing attribute is common (e.g. a bean of an older hadoop version) and
+// logging it would repeat on every scrape. An attribute of another type fails the collector, see
+// gatherCollector
+func (b Bean) parseError(attr string, err error) {
+	if b.errs != nil && !errors.Is(err, errMissing) {
+		b.errs.Add(1)
+	}
+	parseErrors.WithLabelValues(b.Name(), attr).Inc()
+}
+
+// collectGauge sends attr of b to ch as a gauge with the given labels, nothing is sent when attr is
+// unusable so it is not exported as 0
+func collectGauge(ch chan<- prometheus.Metric, desc *prometheus.Desc, b Bean, attr string, labels ...string) {
+	collectValue(ch, desc, prometheus.GaugeValue, b, attr, labels...)
+}
+
+// collectCounter is collectGauge for the cumulative values of newCounterDesc
+func (c counters) collectCounter(ch chan<- prometheus.Metric, desc *prometheus.Desc, b Bean, attr string, labels ...string) {
+	collectValue(ch, desc, c.counterValueType(), b, attr, labels...)
+}
+
+func collectValue(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, b Bean, attr string, labels ...string) {
+	if v, ok := b.float(attr); ok {
+		ch <- prometheus.MustNewConstMetric(desc, valueType, v, labels...)
+	}
+}
+
+// parseBeanName parses the name of a bean, ok is false when it is no ObjectName
+func parseBeanName(name string) (jmx.ObjectName, bool) {
+	o, err := jmx.ParseObjectName(name)
+	return o, err == nil
+}
+
+// canonicalName returns the canonical form of the ObjectName s, or s itself if it does not parse
+func canonicalName(s string) string {
+	if o, ok := parseBeanName(s); ok {
+		return o.String()
+	}
+	return s
+}
@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hadoop_jmx_exporter/jmx"
+)
+
+const accessorBeans = `{"beans":[{
+	"name": "java.lang:type=Memory",
+	"Verbose": false,
+	"ObjectPendingFinalizationCount": 0,
+	"HeapMemoryUsage": {"committed": 1024, "init": 512, "max": 4096, "used": 768},
+	"ObjectName": "java.lang:type=Memory",
+	"Missing": null
+}]}`
+
+func accessorBean(t *testing.T) Bean {
+	t.Helper()
+	idx, err := decodeBeans([]byte(accessorBeans))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, ok := idx.Get("java.lang:type=Memory")
+	if !ok {
+		t.Fatal("bean java.lang:type=Memory not found")
+	}
+	return b
+}
+
+func TestBeanFloat(t *testing.T) {
+	b := accessorBean(t)
+	tests := []struct {
+		attr    string
+		want    float64
+		wantErr string
+	}{
+		{attr: "ObjectPendingFinalizationCount", want: 0},
+		{attr: "NoSuchAttribute", wantErr: "missing"},
+		{attr: "Missing", wantErr: "missing"},
+		{attr: "ObjectName", wantErr: "is a string, not a number"},
+		{attr: "Verbose", wantErr: "is a boolean, not a number"},
+		{attr: "HeapMemoryUsage", wantErr: "is an object, not a number"},
+	}
+	for _, tt := range tests {
+		got, err := b.Float(tt.attr)
+		checkAccessorError(t, tt.attr, err, tt.wantErr)
+		if err == nil && got != tt.want {
+			t.Errorf("Float(%q) = %v, want %v", tt.attr, got, tt.want)
+		}
+	}
+}
+
+func TestBeanString(t *testing.T) {
+	b := accessorBean(t)
+	tests := []struct {
+		attr    string
+		want    string
+		wantErr string
+	}{
+		{attr: "ObjectName", want: "java.lang:type=Memory"},
+		{attr: "NoSuchAttribute", wantErr: "missing"},
+		{attr: "ObjectPendingFinalizationCount", wantErr: "is a number, not a string"},
+		{attr: "HeapMemoryUsage", wantErr: "is an object, not a string"},
+	}
+	for _, tt := range tests {
+		got, err := b.String(tt.attr)
+		checkAccessorError(t, tt.attr, err, tt.wantErr)
+		if err == nil && got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.attr, got, tt.want)
+		}
+	}
+}
+
+func TestBeanMap(t *testing.T) {
+	b := accessorBean(t)
+
+	heap, err := b.Map("HeapMemoryUsage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heap.Name() != b.Name() {
+		t.Errorf("Map kept name %q, want %q", heap.Name(), b.Name())
+	}
+	if used, err := heap.Float("used"); err != nil || used != 768 {
+		t.Errorf("HeapMemoryUsage.used = %v, %v, want 768", used, err)
+	}
+	if _, err := heap.Float("peak"); err == nil || !strings.Contains(err.Error(), "java.lang:type=Memory") {
+		t.Errorf("error of a missing composite attribute %v does not name the bean", err)
+	}
+
+	for attr, wantErr := range map[string]string{
+		"NoSuchAttribute":                "missing",
+		"Missing":                        "missing",
+		"ObjectPendingFinalizationCount": "is a number, not an object",
+		"ObjectName":                     "is a string, not an object",
+	} {
+		_, err := b.Map(attr)
+		checkAccessorError(t, attr, err, wantErr)
+	}
+}
+
+func checkAccessorError(t *testing.T, attr string, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("%s: unexpected error %v", attr, err)
+	case want != "" && err == nil:
+		t.Errorf("%s: no error, want one containing %q", attr, want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Errorf("%s: error %q does not contain %q", attr, err, want)
+	}
+}
+
+func TestDecodeBeansInvalidBody(t *testing.T) {
+	bodies := map[string]string{
+		"html login page": "<html><head><title>Error 401 Authentication required</title></head><body></body></html>",
+		"no beans":        `{"status":"ok"}`,
+		"truncated":       `{"beans":[{"name":"java.lang:type=Memory",`,
+		"beans not array": `{"beans":{"name":"java.lang:type=Memory"}}`,
+	}
+	for name, body := range bodies {
+		if idx, err := decodeBeans([]byte(body)); err == nil {
+			t.Errorf("%s: decoded %d beans, want an error", name, len(idx.Beans()))
+		}
+	}
+}
+
+// /jmx responses of a NameNode with 300 DataNodes and of a ResourceManager with 60 queues
+var benchmarkPayloads = []string{"namenode", "resourcemanager"}
+
+func readPayload(b *testing.B, name string) []byte {
+	b.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+func BenchmarkDecodeBeans(b *testing.B) {
+	for _, name := range benchmarkPayloads {
+		data := readPayload(b, name)
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := decodeBeans(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDecodeInterface decodes like a scrape did before BeanIndex, the whole response into
+// interface{} once to detect the collector and once more in the collector
+func BenchmarkDecodeInterface(b *testing.B) {
+	for _, name := range benchmarkPayloads {
+		data := readPayload(b, name)
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, stage := range []string{"detection", "collector"} {
+					var f interface{}
+					if err := json.Unmarshal(data, &f); err != nil {
+						b.Fatal(stage, err)
+					}
+					for _, bean := range f.(map[string]interface{})["beans"].([]interface{}) {
+						_ = bean.(map[string]interface{})["name"]
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBeanIndexMatch(b *testing.B) {
+	patterns := map[string]string{
+		"namenode":        "Hadoop:service=NameNode,name=RpcActivityForPort*",
+		"resourcemanager": "Hadoop:service=ResourceManager,name=QueueMetrics,*",
+	}
+	for _, name := range benchmarkPayloads {
+		idx, err := decodeBeans(readPayload(b, name))
+		if err != nil {
+			b.Fatal(err)
+		}
+		pattern, err := jmx.ParseObjectNamePattern(patterns[name])
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if len(idx.Match(pattern)) == 0 {
+					b.Fatal("no bean matches ", pattern)
+				}
+			}
+		})
+	}
+}
@@ -1,31 +1,54 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"hadoop_jmx_exporter/config"
 	"hadoop_jmx_exporter/lib"
-	"io"
-	"net/http"
-	"regexp"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 
 	"github.com/prometheus/client_golang/prometheus"
+	promconfig "github.com/prometheus/common/config"
 )
 
 type CollectorFunc func(target Target, registry *prometheus.Registry) bool
 
 type Target struct {
-	Url           string
-	ExporterName  string
-	BodyData      []byte
+	Url string
+	// collectors to run, set by the module or the collector parameter or detected from the beans
+	ExporterNames []string
+	// beans of the /jmx response, set by getCollectorNames
+	Beans *BeanIndex
+	// set for all but the first collector of a process so the JVM and OS metrics are exported once
+	SkipJvmMetrics bool
+	// rules of the module and the configuration, evaluated after the collectors
+	Rules []config.Rule
+	// none, simple, kerberos or basic, see authMode
+	AuthMode string
+	// user of simple and basic auth
+	User          string
+	Password      string
 	KrbAuthMethod string
 	KrbPrincipal  string
 	KrbPassword   string
 	KrbKtPath     string
-	Logger        log.Logger
+	KrbCCachePath string
+	Krb5Config    lib.Krb5Config
+	TLSConfig     *promconfig.TLSConfig
+	// timeout of the module, the scrape timeout sent by Prometheus applies too
+	Timeout time.Duration
+	Logger  log.Logger
+	// options of the exporter, set by Handler
+	Settings Settings
+	// status code of the last response of the target, recorded by fetch when set
+	statusCode *atomic.Int32
 }
 
 var (
@@ -39,95 +62,219 @@ var (
 		"HbaseMaster":       HbaseMasterCollector,
 		"HbaseRegionServer": HbaseRegionServerCollector,
 	}
-)
-
-func (t *Target) getCollectorName() error {
 
-	var data []byte
-	var err error
+	// ObjectName patterns of the beans each collector reads, fetched with /jmx?qry= when the collector is known
+	CollectorQueries = map[string][]string{
+		"NameNode":          nameNodeQueries,
+		"DataNode":          dataNodeQueries,
+		"ResourceManager":   resourceManagerQueries,
+		"JournalNode":       journalNodeQueries,
+		"hiveserver2":       hiveServer2Queries,
+		"NodeManager":       nodeManagerQueries,
+		"HbaseMaster":       hbaseMasterQueries,
+		"HbaseRegionServer": hbaseRegionServerQueries,
+	}
+)
 
-	UrlHostname, err := lib.ExtractDomainFromURL(t.Url)
+// register registers the metrics of a collector, an inconsistent collector is logged and fails the
+// scrape instead of panicking like MustRegister
+func register(target Target, registry *prometheus.Registry, metrics prometheus.Collector) bool {
+	if err := registry.Register(metrics); err != nil {
+		level.Error(target.Logger).Log("msg", "Error register collector", "err", err)
+		return false
+	}
+	return true
+}
 
-	if err != nil {
-		level.Error(t.Logger).Log("msg", "Error extract domain from url", "err", err)
-		return err
+// ValidateCollectors registers the collectors with a pedantic registry, each one first and together with all
+// the others like the services of one process, so duplicate or inconsistent descs fail at startup
+// instead of failing scrapes
+func ValidateCollectors(logger log.Logger, settings Settings) error {
+	names := make([]string, 0, len(Collectors))
+	for name := range Collectors {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	if UrlHostname == "127.0.0.1" {
-		resp, err := http.Get(t.Url)
-		if err != nil {
-			level.Error(t.Logger).Log("msg", "Error get url", "err", err)
+	for _, first := range names {
+		registry := prometheus.NewPedanticRegistry()
 
-			return err
+		t := Target{Beans: &BeanIndex{}, Logger: logger, Settings: settings}
+		if !Collectors[first](t, registry) || !register(t, registry, NewJvmMetrics(t, first)) {
+			return fmt.Errorf("collector %s is invalid", first)
 		}
-		defer resp.Body.Close()
-
-		data, err = io.ReadAll(resp.Body)
-		if err != nil {
-			level.Error(t.Logger).Log("msg", "Error read resp.body", "err", err)
+		t.SkipJvmMetrics = true
+		for _, name := range names {
+			if name != first && !Collectors[name](t, registry) {
+				return fmt.Errorf("collector %s is invalid together with %s", name, first)
+			}
+		}
+		if _, err := registry.Gather(); err != nil {
 			return err
 		}
-	} else {
+	}
+	return nil
+}
+
+func (t *Target) getCollectorNames(ctx context.Context) error {
 
-		if t.KrbAuthMethod == "password" {
-			data, err = lib.MakeKrb5RequestWithPassword(t.KrbPrincipal, t.KrbPassword, t.Url)
+	// collectors are set by the module or the collector parameter, skip detection
+	override := len(t.ExporterNames) > 0
 
-		} else if t.KrbAuthMethod == "keytab" {
-			data, err = lib.MakeKrb5RequestWithKeytab(t.KrbKtPath, t.KrbPrincipal, t.Url)
+	info := cachedTargetInfo(t.Url)
+	if !override {
+		t.ExporterNames = info.collectors
+	}
 
-		} else {
-			level.Error(t.Logger).Log("msg", "Unsupported auth method")
-			return fmt.Errorf("unsupported auth method")
+	// the collectors are known, only fetch the beans they read
+	if queries, ok := collectorQueries(t.ExporterNames, !override); ok && !info.noQry {
+		for _, pattern := range rulePatterns(t.Rules) {
+			if !containsString(queries, pattern) {
+				queries = append(queries, pattern)
+			}
 		}
 
-		if err != nil {
-			level.Error(t.Logger).Log("msg", "Error make krb5 request", "err", err)
+		beans, err := t.fetchBeans(ctx, queries)
+		switch {
+		case err == nil && (override || hasMarkers(beans, t.ExporterNames)):
+			t.Beans = beans
+			return nil
+		case err == nil:
+			level.Info(t.Logger).Log("msg", "Beans of the cached collectors are gone, detecting again", "collectors", strings.Join(t.ExporterNames, ","))
+			updateTargetInfo(t.Url, t.Settings.DetectionCacheTTL, func(info *targetInfo) { info.collectors = nil })
+			t.ExporterNames = nil
+		case ctx.Err() != nil:
 			return err
+		case errors.Is(err, errQryUnsupported):
+			level.Warn(t.Logger).Log("msg", "Jmx servlet does not support qry, fetching the full jmx output", "err", err)
+			updateTargetInfo(t.Url, t.Settings.DetectionCacheTTL, func(info *targetInfo) { info.noQry = true })
+		default:
+			// the error may be transient, qry is tried again on the next scrape
+			level.Warn(t.Logger).Log("msg", "Error fetch beans with qry, falling back to the full jmx output", "err", err)
 		}
-
 	}
 
-	t.BodyData = data
-
-	var f interface{}
-	err = json.Unmarshal(data, &f)
+	data, err := t.fetch(ctx, t.Url)
 	if err != nil {
-		level.Error(t.Logger).Log("msg", "Error json Unmarshal", "err", err)
 		return err
 	}
 
-	m := f.(map[string]interface{})
-	// [{"name":"Hadoop:service=NameNode,name=FSNamesystem", ...}, {"name":"java.lang:type=MemoryPool,name=Code Cache", ...}, ...]
-	var nameList = m["beans"].([]interface{})
-	for _, nameData := range nameList {
-		nameDataMap := nameData.(map[string]interface{})
+	beans, err := decodeBeans(data)
+	if err != nil {
+		level.Error(t.Logger).Log("msg", "Error parse jmx response", "err", err)
+		return &scrapeError{stage: StageParse, reason: "invalid_response", err: err}
+	}
+
+	t.Beans = beans
+
+	if override {
+		return nil
+	}
+	if len(t.ExporterNames) > 0 && hasMarkers(beans, t.ExporterNames) {
+		return nil
+	}
+
+	t.ExporterNames = detectCollectors(beans)
+	// the rules may still match beans of an unknown service
+	if len(t.ExporterNames) == 0 && len(t.Rules) == 0 {
+		level.Error(t.Logger).Log("msg", "Error pattern not match,unknown jmx service")
 
-		if strings.HasPrefix(nameDataMap["name"].(string), "Hadoop:service=") {
+		return &scrapeError{stage: StageDetect, reason: "unknown_service", err: fmt.Errorf("pattern not match,unknown jmx service")}
+	}
 
-			regex := regexp.MustCompile(`Hadoop:service=(.*?),`)
+	collectors := t.ExporterNames
+	updateTargetInfo(t.Url, t.Settings.DetectionCacheTTL, func(info *targetInfo) { info.collectors = collectors })
+	return nil
+}
 
-			match := regex.FindStringSubmatch(nameDataMap["name"].(string))
+// detectCollectors returns the collectors of every service in beans, in the order the services first
+// appear, a process can run more than one service, e.g. a DataNode with an embedded Router. Services
+// without a collector are returned by their name and get the generic collector
+func detectCollectors(beans *BeanIndex) []string {
+	var names []string
 
-			if len(match) > 1 {
+	// [{"name":"Hadoop:service=NameNode,name=FSNamesystem", ...}, {"name":"java.lang:type=MemoryPool,name=Code Cache", ...}, ...]
+	for _, bean := range beans.Beans() {
+		o, ok := bean.ObjectName()
+		if !ok || o.Domain != "Hadoop" {
+			continue
+		}
+
+		name := o.Props["service"]
+		if name == "HBase" {
+			// Hadoop:service=HBase,name=Master,sub=Server, both run in a local mode master
+			switch o.Props["name"] {
+			case "Master":
+				name = "HbaseMaster"
+			case "RegionServer":
+				name = "HbaseRegionServer"
+			}
+		}
 
-				if match[1] == "HBase" {
-					if strings.Contains(nameDataMap["name"].(string), "RegionServer") {
-						t.ExporterName = "HbaseRegionServer"
-						break
-					} else if strings.Contains(nameDataMap["name"].(string), "Master") {
-						t.ExporterName = "HbaseMaster"
-						break
-					}
-				}
+		if name != "" && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
 
-				t.ExporterName = match[1]
+	// the JvmMetrics and friends of an HBase master or region server are not a service of their own
+	if containsString(names, "HbaseMaster") || containsString(names, "HbaseRegionServer") {
+		for i, name := range names {
+			if name == "HBase" {
+				names = append(names[:i], names[i+1:]...)
 				break
-			} else {
-				level.Error(t.Logger).Log("msg", "Error pattern not match,unknown jmx service", "err", err)
+			}
+		}
+	}
+	return names
+}
 
-				return fmt.Errorf("pattern not match,unknown jmx service")
+// collectorFor returns the collector of name, services without a collector of their own get the
+// generic one, see GenericMetrics
+func collectorFor(name string) CollectorFunc {
+	if collector, ok := Collectors[name]; ok {
+		return collector
+	}
+	return GenericCollector(name)
+}
+
+// collectorQueries returns the ObjectName patterns read by collectors, with their markers when
+// withMarkers is set, ok is false when a collector does not declare its beans
+func collectorQueries(collectors []string, withMarkers bool) ([]string, bool) {
+	var queries []string
+	for _, name := range collectors {
+		q, ok := CollectorQueries[name]
+		if _, known := Collectors[name]; !known {
+			// the generic collector reads all beans of its service
+			q, ok = []string{genericPattern(name)}, true
+		}
+		if !ok {
+			return nil, false
+		}
+		if marker := collectorMarker(name); withMarkers && !containsString(queries, marker) {
+			queries = append(queries, marker)
+		}
+		for _, query := range q {
+			if !containsString(queries, query) {
+				queries = append(queries, query)
 			}
 		}
 	}
-	return nil
+	// every process has the beans of JvmMetrics
+	if len(queries) > 0 {
+		for _, query := range jvmQueries {
+			if !containsString(queries, query) {
+				queries = append(queries, query)
+			}
+		}
+	}
+	return queries, len(queries) > 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
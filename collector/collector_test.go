@@ -0,0 +1,15 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestValidateCollectors(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		if err := ValidateCollectors(log.NewNopLogger(), Settings{LegacyGaugeNames: legacy}); err != nil {
+			t.Errorf("legacy gauge names %v: %v", legacy, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hadoop's AuthenticationFilter answers an authenticated request with a signed hadoop.auth cookie,
+// sending it back on the next scrapes skips the authentication until the token expires.
+const hadoopAuthCookieName = "hadoop.auth"
+
+// hadoopAuthTokenValidity is the default of hadoop.http.authentication.token.validity, used when
+// the expiry of a cookie is unknown
+const hadoopAuthTokenValidity = 10 * time.Hour
+
+type hadoopAuthCookie struct {
+	value   string
+	expires time.Time
+}
+
+var hadoopAuthCookies = struct {
+	sync.Mutex
+	cookies map[string]hadoopAuthCookie
+}{cookies: map[string]hadoopAuthCookie{}}
+
+// cookieKey identifies a cookie by the host it came from and the user it was issued to
+func (t *Target) cookieKey(jmxUrl string) string {
+	u, err := url.Parse(jmxUrl)
+	if err != nil {
+		return ""
+	}
+	return u.Host + "|" + t.authMode() + "|" + t.User
+}
+
+// addHadoopAuthCookie adds the stored cookie to req, it returns false if there is none
+func (t *Target) addHadoopAuthCookie(req *http.Request) bool {
+	key := t.cookieKey(req.URL.String())
+
+	hadoopAuthCookies.Lock()
+	cookie, ok := hadoopAuthCookies.cookies[key]
+	if ok && time.Now().After(cookie.expires) {
+		delete(hadoopAuthCookies.cookies, key)
+		ok = false
+	}
+	hadoopAuthCookies.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	// the value contains '=' and '&', hadoop's own client sends it quoted
+	req.Header.Add("Cookie", hadoopAuthCookieName+"=\""+cookie.value+"\"")
+	return true
+}
+
+// storeHadoopAuthCookie keeps the hadoop.auth cookie of resp, an empty value means the server
+// rejected the token. The cookies of hosts that are no longer scraped are removed once they expired
+func (t *Target) storeHadoopAuthCookie(jmxUrl string, resp *http.Response) {
+	for _, c := range resp.Cookies() {
+		if c.Name != hadoopAuthCookieName {
+			continue
+		}
+
+		key := t.cookieKey(jmxUrl)
+
+		hadoopAuthCookies.Lock()
+		if c.Value == "" || c.MaxAge < 0 {
+			delete(hadoopAuthCookies.cookies, key)
+		} else {
+			now := time.Now()
+			for k, old := range hadoopAuthCookies.cookies {
+				if now.After(old.expires) {
+					delete(hadoopAuthCookies.cookies, k)
+				}
+			}
+			hadoopAuthCookies.cookies[key] = hadoopAuthCookie{value: c.Value, expires: cookieExpiry(c, now)}
+		}
+		hadoopAuthCookies.Unlock()
+	}
+}
+
+// cookieExpiry returns when c expires. The cookie is a session cookie unless
+// hadoop.http.authentication.cookie.persistent is set, the token in its value expires anyway,
+// e.g. u=hdfs&p=hdfs@EXAMPLE.COM&t=kerberos&e=1700000000000&s=...
+func cookieExpiry(c *http.Cookie, now time.Time) time.Time {
+	if c.MaxAge > 0 {
+		return now.Add(time.Duration(c.MaxAge) * time.Second)
+	}
+	if !c.Expires.IsZero() {
+		return c.Expires
+	}
+	for _, field := range strings.Split(strings.Trim(c.Value, `"`), "&") {
+		if millis, ok := strings.CutPrefix(field, "e="); ok {
+			if ms, err := strconv.ParseInt(millis, 10, 64); err == nil {
+				return time.UnixMilli(ms)
+			}
+		}
+	}
+	return now.Add(hadoopAuthTokenValidity)
+}
+
+func (t *Target) dropHadoopAuthCookie(jmxUrl string) {
+	hadoopAuthCookies.Lock()
+	delete(hadoopAuthCookies.cookies, t.cookieKey(jmxUrl))
+	hadoopAuthCookies.Unlock()
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCookieExpiry(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		cookie http.Cookie
+		want   time.Time
+	}{
+		{
+			name:   "max age",
+			cookie: http.Cookie{Value: "u=hdfs&e=1700000000000", MaxAge: 60},
+			want:   now.Add(time.Minute),
+		},
+		{
+			name:   "persistent cookie",
+			cookie: http.Cookie{Value: "u=hdfs&e=1700000000000", Expires: now.Add(time.Hour)},
+			want:   now.Add(time.Hour),
+		},
+		{
+			name:   "session cookie",
+			cookie: http.Cookie{Value: `"u=hdfs&p=hdfs@EXAMPLE.COM&t=kerberos&e=1700000000000&s=abc="`},
+			want:   time.UnixMilli(1700000000000),
+		},
+		{
+			name:   "unknown expiry",
+			cookie: http.Cookie{Value: "opaque"},
+			want:   now.Add(hadoopAuthTokenValidity),
+		},
+	}
+	for _, tt := range tests {
+		if got := cookieExpiry(&tt.cookie, now); !got.Equal(tt.want) {
+			t.Errorf("%s: expiry %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStoreHadoopAuthCookieSweepsExpired(t *testing.T) {
+	hadoopAuthCookies.Lock()
+	hadoopAuthCookies.cookies["gone:9870|simple|"] = hadoopAuthCookie{value: "old", expires: time.Now().Add(-time.Minute)}
+	hadoopAuthCookies.Unlock()
+
+	target := &Target{}
+	resp := &http.Response{Header: http.Header{"Set-Cookie": {"hadoop.auth=\"u=hdfs&e=" +
+		"9999999999999\"; Path=/; HttpOnly"}}}
+	target.storeHadoopAuthCookie("http://nn:9870/jmx", resp)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://nn:9870/jmx", nil)
+	if !target.addHadoopAuthCookie(req) {
+		t.Fatal("stored cookie not added")
+	}
+
+	hadoopAuthCookies.Lock()
+	defer hadoopAuthCookies.Unlock()
+	if _, ok := hadoopAuthCookies.cookies["gone:9870|simple|"]; ok {
+		t.Error("expired cookie kept after storing a new one")
+	}
+}
@@ -1,22 +1,19 @@
 package collector
 
 import (
-	"encoding/json"
-
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/log"
 )
 
 type DataNodeMetrics struct {
 	BaseMetrics
-	Capacity              *prometheus.GaugeVec
-	CacheCapacity         prometheus.Gauge
-	CacheUsed             prometheus.Gauge
-	FailedVolumes         prometheus.Gauge
-	EstimatedCapacityLost prometheus.Gauge
-	BlocksCached          prometheus.Gauge
-	BlocksFailedToCache   prometheus.Gauge
-	BlocksFailedToUncache prometheus.Gauge
+	Capacity              *prometheus.Desc
+	CacheCapacity         *prometheus.Desc
+	CacheUsed             *prometheus.Desc
+	FailedVolumes         *prometheus.Desc
+	EstimatedCapacityLost *prometheus.Desc
+	BlocksCached          *prometheus.Desc
+	BlocksFailedToCache   *prometheus.Desc
+	BlocksFailedToUncache *prometheus.Desc
 }
 
 func NewDataNodeMetrics(t Target) *DataNodeMetrics {
@@ -24,115 +21,65 @@ func NewDataNodeMetrics(t Target) *DataNodeMetrics {
 	const namespace = "hdfs_datanode"
 
 	return &DataNodeMetrics{
-		BaseMetrics: BuildBaseMetrics(t.BodyData, namespace),
-		Capacity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "fsname_system",
-			Name:      "capacity_bytes",
-			Help:      "Current DataNodes capacity in each mode in bytes",
-		}, []string{"mode"}),
-		CacheCapacity: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "CacheCapacity",
-			Help:      "CacheCapacity",
-		}),
-		CacheUsed: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "CacheUsed",
-			Help:      "CacheUsed",
-		}),
-
-		FailedVolumes: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "FailedVolumes",
-			Help:      "FailedVolumes",
-		}),
-		EstimatedCapacityLost: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "EstimatedCapacityLost",
-			Help:      "EstimatedCapacityLost",
-		}),
-
-		BlocksCached: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "BlocksCached",
-			Help:      "BlocksCached",
-		}),
-		BlocksFailedToCache: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "BlocksFailedToCache",
-			Help:      "BlocksFailedToCache",
-		}),
-		BlocksFailedToUncache: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "BlocksFailedToUncache",
-			Help:      "BlocksFailedToUncache",
-		}),
+		BaseMetrics:   BuildBaseMetrics(t, namespace),
+		Capacity:      newDesc(namespace, "fsname_system", "capacity_bytes", "Current DataNodes capacity in each mode in bytes", "mode"),
+		CacheCapacity: newDesc(namespace, "", "CacheCapacity", "CacheCapacity"),
+		CacheUsed:     newDesc(namespace, "", "CacheUsed", "CacheUsed"),
+
+		FailedVolumes:         newDesc(namespace, "", "FailedVolumes", "FailedVolumes"),
+		EstimatedCapacityLost: newDesc(namespace, "", "EstimatedCapacityLost", "EstimatedCapacityLost"),
+
+		BlocksCached:          newDesc(namespace, "", "BlocksCached", "BlocksCached"),
+		BlocksFailedToCache:   newDesc(namespace, "", "BlocksFailedToCache", "BlocksFailedToCache"),
+		BlocksFailedToUncache: newDesc(namespace, "", "BlocksFailedToUncache", "BlocksFailedToUncache"),
 	}
 }
 
+func (e *DataNodeMetrics) Describe(ch chan<- *prometheus.Desc) {
+	e.BaseMetrics.Describe(ch)
+	ch <- e.Capacity
+	ch <- e.CacheCapacity
+	ch <- e.CacheUsed
+	ch <- e.FailedVolumes
+	ch <- e.EstimatedCapacityLost
+	ch <- e.BlocksCached
+	ch <- e.BlocksFailedToCache
+	ch <- e.BlocksFailedToUncache
+}
+
 // Collect implements the prometheus.Collector interface.
 func (e *DataNodeMetrics) Collect(ch chan<- prometheus.Metric) {
-	var err error
+	if bean, ok := e.Beans.Get("Hadoop:service=DataNode,name=FSDatasetState"); ok {
 
-	var f interface{}
-	err = json.Unmarshal(e.BodyData, &f)
-	if err != nil {
-		log.Error(err)
+		collectGauge(ch, e.Capacity, bean, "Capacity", "Total")
+		collectGauge(ch, e.Capacity, bean, "DfsUsed", "DfsUsed")
+		collectGauge(ch, e.Capacity, bean, "Remaining", "Remaining")
+
+		collectGauge(ch, e.CacheCapacity, bean, "CacheCapacity")
+		collectGauge(ch, e.CacheUsed, bean, "CacheUsed")
+
+		collectGauge(ch, e.FailedVolumes, bean, "NumFailedVolumes")
+		collectGauge(ch, e.EstimatedCapacityLost, bean, "EstimatedCapacityLostTotal")
+
+		collectGauge(ch, e.BlocksCached, bean, "NumBlocksCached")
+		collectGauge(ch, e.BlocksFailedToCache, bean, "NumBlocksFailedToCache")
+		collectGauge(ch, e.BlocksFailedToUncache, bean, "NumBlocksFailedToUncache")
 	}
-	m := f.(map[string]interface{})
-	var List = m["beans"].([]interface{})
-	for _, Data := range List {
-		DataMap := Data.(map[string]interface{})
-		if DataMap["name"] == "Hadoop:service=DataNode,name=FSDatasetState" {
-
-			e.Capacity.WithLabelValues("Total").Set(DataMap["Capacity"].(float64))
-			e.Capacity.WithLabelValues("DfsUsed").Set(DataMap["DfsUsed"].(float64))
-			e.Capacity.WithLabelValues("Remaining").Set(DataMap["Remaining"].(float64))
-
-			e.CacheCapacity.Set(DataMap["CacheCapacity"].(float64))
-			e.CacheUsed.Set(DataMap["CacheUsed"].(float64))
-
-			e.FailedVolumes.Set(DataMap["NumFailedVolumes"].(float64))
-			e.EstimatedCapacityLost.Set(DataMap["EstimatedCapacityLostTotal"].(float64))
-
-			e.BlocksCached.Set(DataMap["NumBlocksCached"].(float64))
-			e.BlocksFailedToCache.Set(DataMap["NumBlocksFailedToCache"].(float64))
-			e.BlocksFailedToUncache.Set(DataMap["NumBlocksFailedToUncache"].(float64))
-		}
-
-		if DataMap["name"] == "Hadoop:service=DataNode,name=JvmMetrics" {
-			e.GcCount.WithLabelValues("ParNew").Set(DataMap["GcCountParNew"].(float64))
-			e.GcCount.WithLabelValues("ConcurrentMarkSweep").Set(DataMap["GcCountConcurrentMarkSweep"].(float64))
-
-			e.GcTime.WithLabelValues("ParNew").Set(DataMap["GcTimeMillisParNew"].(float64))
-			e.GcTime.WithLabelValues("ConcurrentMarkSweep").Set(DataMap["GcTimeMillisConcurrentMarkSweep"].(float64))
-
-		}
-		if DataMap["name"] == "java.lang:type=Memory" {
-			heapMemoryUsage := DataMap["HeapMemoryUsage"].(map[string]interface{})
-			e.HeapMemoryUsage.WithLabelValues("committed").Set(heapMemoryUsage["committed"].(float64))
-			e.HeapMemoryUsage.WithLabelValues("init").Set(heapMemoryUsage["init"].(float64))
-			e.HeapMemoryUsage.WithLabelValues("max").Set(heapMemoryUsage["max"].(float64))
-			e.HeapMemoryUsage.WithLabelValues("used").Set(heapMemoryUsage["used"].(float64))
-			e.HeapMemoryUsage.Collect(ch)
-
-		}
+
+	e.collectGc(ch, "Hadoop:service=DataNode,name=JvmMetrics")
+	if bean, ok := e.jvmBean("java.lang:type=Memory"); ok {
+		e.collectHeapMemoryUsage(ch, bean)
 	}
-	e.Capacity.Collect(ch)
-	e.CacheCapacity.Collect(ch)
-	e.CacheUsed.Collect(ch)
-	e.FailedVolumes.Collect(ch)
-	e.EstimatedCapacityLost.Collect(ch)
-	e.BlocksCached.Collect(ch)
-	e.BlocksFailedToCache.Collect(ch)
-	e.BlocksFailedToUncache.Collect(ch)
+}
 
+// beans read by DataNodeCollector, see Target.fetchBeans
+var dataNodeQueries = []string{
+	"Hadoop:service=DataNode,name=FSDatasetState",
+	"Hadoop:service=DataNode,name=JvmMetrics",
 }
 
 func DataNodeCollector(target Target, registry *prometheus.Registry) (success bool) {
 
 	metrics := NewDataNodeMetrics(target)
-	registry.MustRegister(metrics)
-	return
+	return register(target, registry, metrics)
 }
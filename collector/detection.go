@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"hadoop_jmx_exporter/jmx"
+)
+
+// collectorMarkers are small beans that exist on every process of the role, cached collectors are
+// detected again when a marker is gone, e.g. when the port was taken over by another daemon
+var collectorMarkers = map[string]string{
+	"NameNode":          "Hadoop:service=NameNode,name=NameNodeStatus",
+	"DataNode":          "Hadoop:service=DataNode,name=DataNodeActivity-*",
+	"ResourceManager":   "Hadoop:service=ResourceManager,name=ClusterMetrics",
+	"JournalNode":       "Hadoop:service=JournalNode,name=JvmMetrics",
+	"hiveserver2":       "Hadoop:service=hiveserver2,*",
+	"NodeManager":       "Hadoop:service=NodeManager,name=NodeManagerMetrics",
+	"HbaseMaster":       "Hadoop:service=HBase,name=Master,*",
+	"HbaseRegionServer": "Hadoop:service=HBase,name=RegionServer,*",
+}
+
+// collectorMarker returns the marker of a collector, for the generic collector of a service any bean
+// of the service will do
+func collectorMarker(name string) string {
+	if marker, ok := collectorMarkers[name]; ok {
+		return marker
+	}
+	return genericPattern(name)
+}
+
+// targetInfo is what is known about a JMX endpoint between scrapes
+type targetInfo struct {
+	// collectors detected from the beans, empty until detection succeeded
+	collectors []string
+	// noQry is set when the servlet does not support /jmx?qry=, the full output is fetched instead
+	noQry   bool
+	expires time.Time
+}
+
+// targetInfos are keyed by target url
+var targetInfos = struct {
+	sync.Mutex
+	m map[string]targetInfo
+}{m: map[string]targetInfo{}}
+
+// cachedTargetInfo returns the unexpired info of url
+func cachedTargetInfo(url string) targetInfo {
+	targetInfos.Lock()
+	defer targetInfos.Unlock()
+
+	info, ok := targetInfos.m[url]
+	if !ok || time.Now().After(info.expires) {
+		delete(targetInfos.m, url)
+		return targetInfo{}
+	}
+	return info
+}
+
+// updateTargetInfo changes the info of url with f, a new entry expires after ttl. The infos of
+// targets that are no longer scraped are removed when a new entry is stored
+func updateTargetInfo(url string, ttl time.Duration, f func(info *targetInfo)) {
+	if ttl <= 0 {
+		return
+	}
+
+	targetInfos.Lock()
+	defer targetInfos.Unlock()
+
+	now := time.Now()
+	info, ok := targetInfos.m[url]
+	if !ok || now.After(info.expires) {
+		for key, old := range targetInfos.m {
+			if now.After(old.expires) {
+				delete(targetInfos.m, key)
+			}
+		}
+		info = targetInfo{expires: now.Add(ttl)}
+	}
+	f(&info)
+	targetInfos.m[url] = info
+}
+
+// hasMarkers reports whether beans contain the marker beans of all collectors
+func hasMarkers(beans *BeanIndex, collectors []string) bool {
+	for _, collector := range collectors {
+		pattern, err := jmx.ParseObjectNamePattern(collectorMarker(collector))
+		if err != nil || len(beans.Match(pattern)) == 0 {
+			return false
+		}
+	}
+	return true
+}
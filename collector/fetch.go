@@ -0,0 +1,268 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hadoop_jmx_exporter/jmx"
+	"hadoop_jmx_exporter/lib"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	promconfig "github.com/prometheus/common/config"
+)
+
+const (
+	AuthNone     = "none"
+	AuthSimple   = "simple"
+	AuthKerberos = "kerberos"
+	AuthBasic    = "basic"
+)
+
+// authMode returns the configured auth mode, without one Kerberos is used when credentials are
+// configured and plain HTTP otherwise
+func (t *Target) authMode() string {
+	if t.AuthMode != "" {
+		return t.AuthMode
+	}
+	if t.KrbAuthMethod != "" {
+		return AuthKerberos
+	}
+	return AuthNone
+}
+
+// transports are shared by every scrape with the same TLS settings so connections are reused
+var transports = struct {
+	sync.Mutex
+	m map[promconfig.TLSConfig]*cachedTransport
+}{m: map[promconfig.TLSConfig]*cachedTransport{}}
+
+type cachedTransport struct {
+	rt       *http.Transport
+	lastUsed time.Time
+}
+
+// transportIdleTimeout is how long a transport is kept without scrapes, e.g. of a removed module
+const transportIdleTimeout = time.Hour
+
+// transport returns the transport for the TLS settings of the target, it is used by plain and SPNEGO requests
+func (t *Target) transport() (http.RoundTripper, error) {
+	if t.TLSConfig == nil {
+		return http.DefaultTransport, nil
+	}
+
+	transports.Lock()
+	defer transports.Unlock()
+
+	now := time.Now()
+	if cached, ok := transports.m[*t.TLSConfig]; ok {
+		cached.lastUsed = now
+		return cached.rt, nil
+	}
+
+	tlsConfig, err := promconfig.NewTLSConfig(t.TLSConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating tls config: %v", err)
+	}
+
+	// the transports of TLS settings no longer used are dropped when a new one is stored
+	for key, cached := range transports.m {
+		if now.Sub(cached.lastUsed) > transportIdleTimeout {
+			cached.rt.CloseIdleConnections()
+			delete(transports.m, key)
+		}
+	}
+
+	rt := http.DefaultTransport.(*http.Transport).Clone()
+	rt.TLSClientConfig = tlsConfig
+	transports.m[*t.TLSConfig] = &cachedTransport{rt: rt, lastUsed: now}
+
+	return rt, nil
+}
+
+// fetch requests jmxUrl with the auth mode of the target and returns the body
+func (t *Target) fetch(ctx context.Context, jmxUrl string) ([]byte, error) {
+
+	rt, err := t.transport()
+	if err != nil {
+		level.Error(t.Logger).Log("msg", "Error create transport", "err", err)
+		return nil, &scrapeError{stage: StageFetch, reason: "tls", err: err}
+	}
+	if t.statusCode != nil {
+		rt = statusRecorder{rt: rt, code: t.statusCode}
+	}
+
+	// the deadline of ctx limits the request, see scrapeTimeout
+	httpClient := &http.Client{Transport: rt}
+
+	switch t.authMode() {
+	case AuthNone:
+		return t.fetchPlain(ctx, httpClient, jmxUrl)
+
+	case AuthSimple:
+		// hadoop.http.authentication.type=simple, the user is passed as user.name
+		if t.User == "" {
+			return nil, &scrapeError{stage: StageAuth, reason: "config", err: fmt.Errorf("auth mode simple requires a user")}
+		}
+		u, err := url.Parse(jmxUrl)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("user.name", t.User)
+		u.RawQuery = q.Encode()
+		return t.fetchPlain(ctx, httpClient, u.String())
+
+	case AuthBasic:
+		return t.fetchPlain(ctx, httpClient, jmxUrl)
+
+	case AuthKerberos:
+		var data []byte
+		var err error
+
+		if t.KrbAuthMethod == "password" {
+			data, err = lib.MakeKrb5RequestWithPassword(ctx, t.KrbPrincipal, t.KrbPassword, t.Krb5Config, httpClient, jmxUrl)
+
+		} else if t.KrbAuthMethod == "keytab" {
+			data, err = lib.MakeKrb5RequestWithKeytab(ctx, t.KrbKtPath, t.KrbPrincipal, t.Krb5Config, httpClient, jmxUrl)
+
+		} else if t.KrbAuthMethod == "ccache" {
+			data, err = lib.MakeKrb5RequestWithCCache(ctx, t.KrbCCachePath, t.Krb5Config, httpClient, jmxUrl)
+
+		} else {
+			level.Error(t.Logger).Log("msg", "Unsupported kerberos auth method", "method", t.KrbAuthMethod)
+			return nil, &scrapeError{stage: StageAuth, reason: "config", err: fmt.Errorf("unsupported kerberos auth method %q", t.KrbAuthMethod)}
+		}
+
+		if err != nil {
+			level.Error(t.Logger).Log("msg", "Error make krb5 request", "err", err)
+			switch {
+			case errors.Is(err, lib.ErrKrb5Auth):
+				return nil, &scrapeError{stage: StageAuth, reason: "kerberos", err: err}
+			case errors.Is(err, lib.ErrHTTPStatus):
+				return nil, &scrapeError{stage: StageFetch, reason: "http_status", err: err}
+			}
+			return nil, &scrapeError{stage: StageFetch, reason: "request", err: err}
+		}
+		return data, nil
+	}
+
+	level.Error(t.Logger).Log("msg", "Unsupported auth mode", "mode", t.AuthMode)
+	return nil, &scrapeError{stage: StageAuth, reason: "config", err: fmt.Errorf("unsupported auth mode %q", t.AuthMode)}
+}
+
+// errQryUnsupported is returned by fetchBeans when the servlet answered a qry with something other
+// than the beans of the pattern, e.g. an error document or the full output of servlets ignoring qry
+var errQryUnsupported = errors.New("jmx servlet does not support qry")
+
+// fetchBeans requests /jmx?qry= for each ObjectName pattern in parallel and merges the beans,
+// it fails if any request fails so the caller can fall back to the full jmx output
+func (t *Target) fetchBeans(ctx context.Context, queries []string) (*BeanIndex, error) {
+	u, err := url.Parse(t.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*BeanIndex, len(queries))
+	errs := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		pattern, err := jmx.ParseObjectNamePattern(query)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("qry", query)
+		qu := *u
+		qu.RawQuery = q.Encode()
+
+		wg.Add(1)
+		go func(i int, qryUrl string) {
+			defer wg.Done()
+
+			data, err := t.fetch(ctx, qryUrl)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			// servlets without qry support answer with an error document or the full output
+			beans, err := decodeBeanList(data)
+			if err == nil && beans == nil {
+				err = fmt.Errorf("no beans in jmx response")
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%w: error decode response of qry %s: %v", errQryUnsupported, queries[i], err)
+				return
+			}
+			for _, bean := range beans.Beans() {
+				if o, ok := bean.ObjectName(); !ok || !o.Match(pattern) {
+					errs[i] = fmt.Errorf("%w: bean %s does not match qry %s", errQryUnsupported, bean.Name(), queries[i])
+					return
+				}
+			}
+			results[i] = beans
+		}(i, qu.String())
+	}
+	wg.Wait()
+
+	idx := &BeanIndex{byName: map[string]int{}}
+	for i := range queries {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		idx.merge(results[i])
+	}
+	return idx, nil
+}
+
+func (t *Target) fetchPlain(ctx context.Context, httpClient *http.Client, jmxUrl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", jmxUrl, nil)
+	if err != nil {
+		level.Error(t.Logger).Log("msg", "Error create request", "err", err)
+		return nil, err
+	}
+
+	if t.authMode() == AuthBasic {
+		req.SetBasicAuth(t.User, t.Password)
+	}
+
+	withCookie := t.addHadoopAuthCookie(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		level.Error(t.Logger).Log("msg", "Error get url", "err", err)
+		return nil, &scrapeError{stage: StageFetch, reason: "request", err: err}
+	}
+	defer resp.Body.Close()
+
+	t.storeHadoopAuthCookie(jmxUrl, resp)
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		// the cookie may have been signed with a secret the server no longer has, retry without it
+		if withCookie {
+			level.Debug(t.Logger).Log("msg", "Request with hadoop.auth cookie not authorized, retrying without it", "status", resp.Status)
+			t.dropHadoopAuthCookie(jmxUrl)
+			return t.fetchPlain(ctx, httpClient, jmxUrl)
+		}
+		level.Error(t.Logger).Log("msg", "Request not authorized", "status", resp.Status, "mode", t.authMode())
+		return nil, &scrapeError{stage: StageAuth, reason: "unauthorized", err: fmt.Errorf("request not authorized: %s", resp.Status)}
+	}
+
+	// the body of an error is an html page, not worth decoding
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		level.Error(t.Logger).Log("msg", "Unexpected status of jmx request", "status", resp.Status)
+		return nil, &scrapeError{stage: StageFetch, reason: "http_status", err: fmt.Errorf("unexpected status: %s", resp.Status)}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		level.Error(t.Logger).Log("msg", "Error read resp.body", "err", err)
+		return nil, &scrapeError{stage: StageFetch, reason: "request", err: err}
+	}
+	return data, nil
+}
@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"hadoop_jmx_exporter/jmx"
+
+	"github.com/go-kit/log"
+)
+
+var nameNodeBeans = []map[string]interface{}{
+	{"name": "Hadoop:service=NameNode,name=NameNodeStatus", "State": "active"},
+	{"name": "Hadoop:service=NameNode,name=FSNamesystem", "MissingBlocks": 0},
+	{"name": "Hadoop:service=NameNode,name=JvmMetrics", "GcCount": 3},
+	{"name": "java.lang:type=Memory", "HeapMemoryUsage": map[string]int{"used": 1}},
+}
+
+// jmxServer is a /jmx servlet, qry answers the requests with a qry parameter and counts them
+type jmxServer struct {
+	*httptest.Server
+	qry func(w http.ResponseWriter, query string)
+
+	mu       sync.Mutex
+	full     int
+	requests int
+}
+
+func newJmxServer(t *testing.T, qry func(w http.ResponseWriter, query string)) *jmxServer {
+	s := &jmxServer{qry: qry}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		query := r.URL.Query().Get("qry")
+		if query == "" {
+			s.full++
+		}
+		s.mu.Unlock()
+
+		if query == "" {
+			writeBeans(w, nameNodeBeans)
+			return
+		}
+		s.qry(w, query)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// counts returns the number of requests and of full requests since the last call
+func (s *jmxServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests, full := s.requests, s.full
+	s.requests, s.full = 0, 0
+	return requests, full
+}
+
+func writeBeans(w http.ResponseWriter, beans []map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"beans": beans})
+}
+
+// supportsQry answers like the hadoop JMXJsonServlet
+func supportsQry(w http.ResponseWriter, query string) {
+	pattern, err := jmx.ParseObjectNamePattern(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	beans := []map[string]interface{}{}
+	for _, bean := range nameNodeBeans {
+		if o, err := jmx.ParseObjectName(bean["name"].(string)); err == nil && o.Match(pattern) {
+			beans = append(beans, bean)
+		}
+	}
+	writeBeans(w, beans)
+}
+
+func scrapeBeans(t *testing.T, url string) *Target {
+	t.Helper()
+	target := &Target{Url: url, Logger: log.NewNopLogger(), Settings: Settings{DetectionCacheTTL: time.Minute}}
+	if err := target.getCollectorNames(context.Background()); err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	if len(target.ExporterNames) != 1 || target.ExporterNames[0] != "NameNode" {
+		t.Fatalf("collectors %v, want NameNode", target.ExporterNames)
+	}
+	if _, ok := target.Beans.Get("Hadoop:service=NameNode,name=FSNamesystem"); !ok {
+		t.Fatal("FSNamesystem not fetched")
+	}
+	return target
+}
+
+func TestFetchQry(t *testing.T) {
+	s := newJmxServer(t, supportsQry)
+	url := s.URL + "/jmx"
+
+	// the first scrape detects the collectors from the full output
+	scrapeBeans(t, url)
+	if _, full := s.counts(); full != 1 {
+		t.Fatalf("first scrape made %d full requests, want 1", full)
+	}
+
+	scrapeBeans(t, url)
+	if requests, full := s.counts(); full != 0 || requests == 0 {
+		t.Errorf("cached scrape made %d requests, %d of them full, want only qry requests", requests, full)
+	}
+	if cachedTargetInfo(url).noQry {
+		t.Error("noQry set for a servlet supporting qry")
+	}
+}
+
+func TestFetchQryIgnored(t *testing.T) {
+	// old servlets and proxies answer every request with the full output
+	s := newJmxServer(t, func(w http.ResponseWriter, query string) {
+		writeBeans(w, nameNodeBeans)
+	})
+	url := s.URL + "/jmx"
+
+	scrapeBeans(t, url)
+	s.counts()
+
+	// the beans not matching the qry are noticed and the full output is used instead
+	scrapeBeans(t, url)
+	if _, full := s.counts(); full != 1 {
+		t.Errorf("scrape after ignored qry made %d full requests, want 1", full)
+	}
+	if !cachedTargetInfo(url).noQry {
+		t.Fatal("noQry not set for a servlet ignoring qry")
+	}
+
+	scrapeBeans(t, url)
+	if requests, full := s.counts(); requests != 1 || full != 1 {
+		t.Errorf("scrape with noQry made %d requests, %d of them full, want a single full request", requests, full)
+	}
+}
+
+func TestFetchQryTransientError(t *testing.T) {
+	var mu sync.Mutex
+	failing := true
+	s := newJmxServer(t, func(w http.ResponseWriter, query string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		supportsQry(w, query)
+	})
+	url := s.URL + "/jmx"
+
+	scrapeBeans(t, url)
+	s.counts()
+
+	// the scrape still succeeds with the full output
+	scrapeBeans(t, url)
+	if _, full := s.counts(); full != 1 {
+		t.Errorf("scrape after failed qry made %d full requests, want 1", full)
+	}
+	if cachedTargetInfo(url).noQry {
+		t.Fatal("noQry set after a transient error")
+	}
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	scrapeBeans(t, url)
+	if requests, full := s.counts(); full != 0 || requests == 0 {
+		t.Errorf("scrape after recovery made %d requests, %d of them full, want only qry requests", requests, full)
+	}
+}
+
+func TestUpdateTargetInfoSweepsExpired(t *testing.T) {
+	updateTargetInfo("http://gone:9870/jmx", time.Minute, func(info *targetInfo) { info.noQry = true })
+	targetInfos.Lock()
+	info := targetInfos.m["http://gone:9870/jmx"]
+	info.expires = time.Now().Add(-time.Second)
+	targetInfos.m["http://gone:9870/jmx"] = info
+	targetInfos.Unlock()
+
+	updateTargetInfo("http://nn:9870/jmx", time.Minute, func(info *targetInfo) {})
+
+	targetInfos.Lock()
+	defer targetInfos.Unlock()
+	if _, ok := targetInfos.m["http://gone:9870/jmx"]; ok {
+		t.Error("expired info kept after storing a new one")
+	}
+}
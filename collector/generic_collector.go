@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"hadoop_jmx_exporter/jmx"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// GenericMetrics exports every numeric attribute of the Hadoop:service=<Service> beans, it runs for the
+// services without a collector like Router, JobHistoryServer or HttpFSServer
+type GenericMetrics struct {
+	Beans          *BeanIndex
+	SkipJvmMetrics bool
+	Service        string
+	Logger         log.Logger
+}
+
+func NewGenericMetrics(t Target, service string) *GenericMetrics {
+	return &GenericMetrics{
+		Beans:          t.Beans,
+		SkipJvmMetrics: t.SkipJvmMetrics,
+		Service:        service,
+		Logger:         t.Logger,
+	}
+}
+
+func (e *GenericMetrics) Describe(ch chan<- *prometheus.Desc) {
+
+}
+
+// Collect implements the prometheus.Collector interface.
+// Hadoop:service=Router,name=FederationRPC {"ProxyOp": 12, "tag.Hostname": "host1"} is exported as
+// hadoop_router_federation_rpc_proxy_op{hostname="host1"} 12, the tag.* attributes and the key
+// properties other than service and name are labels
+func (e *GenericMetrics) Collect(ch chan<- prometheus.Metric) {
+	pattern, err := jmx.ParseObjectNamePattern(genericPattern(e.Service))
+	if err != nil {
+		level.Error(e.Logger).Log("msg", "Error parse pattern of service", "service", e.Service, "err", err)
+		return
+	}
+	unique := newUniqueMetrics()
+
+	for _, bean := range e.Beans.Match(pattern) {
+		o, _ := bean.ObjectName()
+		if o.Props["name"] == "JvmMetrics" && e.SkipJvmMetrics {
+			continue
+		}
+
+		prefix := "hadoop_" + snakeCase(e.Service) + "_"
+		if name := strings.Trim(o.Props["name"], `"`); name != "" {
+			prefix += snakeCase(name) + "_"
+		}
+
+		labels := map[string]string{}
+		for key, value := range o.Props {
+			if key != "service" && key != "name" {
+				labels[sanitizeLabelName(snakeCase(key))] = strings.Trim(value, `"`)
+			}
+		}
+		for attr := range bean.attrs {
+			if !strings.HasPrefix(attr, "tag.") {
+				continue
+			}
+			label := sanitizeLabelName(snakeCase(strings.TrimPrefix(attr, "tag.")))
+			if _, ok := labels[label]; ok {
+				continue
+			}
+			// tags are strings, a missing one is not worth a parse error
+			if value, err := bean.String(attr); err == nil {
+				labels[label] = value
+			}
+		}
+
+		labelNames := make([]string, 0, len(labels))
+		for label := range labels {
+			labelNames = append(labelNames, label)
+		}
+		sort.Strings(labelNames)
+		labelValues := make([]string, len(labelNames))
+		for i, label := range labelNames {
+			labelValues[i] = labels[label]
+		}
+
+		for _, attr := range bean.Numbers() {
+			name := sanitizeMetricName(prefix + snakeCase(attr.Name))
+			err := unique.send(ch, name, "Attribute "+attr.Name+" of "+bean.Name(), prometheus.UntypedValue, attr.Value, labelNames, labelValues)
+			if err != nil {
+				level.Error(e.Logger).Log("msg", "Error create metric", "bean", bean.Name(), "attribute", attr.Name, "err", err)
+			}
+		}
+	}
+}
+
+// genericPattern matches the beans of a service without a collector
+func genericPattern(service string) string {
+	return "Hadoop:service=" + service + ",*"
+}
+
+// validServiceName reports whether service can be the value of the service key property of a
+// Hadoop bean, anything else would change the pattern of the generic collector
+func validServiceName(service string) bool {
+	return service != "" && !strings.ContainsAny(service, ",=:*?\"\n")
+}
+
+// snakeCase turns JMX names like FSNamesystem, RpcQueueTimeNumOps or HeapMemoryUsage.used into
+// fs_namesystem, rpc_queue_time_num_ops and heap_memory_usage_used
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUpper(c) && i > 0 {
+			prev := s[i-1]
+			// a new word starts after a lower case letter or a digit, or at the last capital of an acronym
+			if isLower(prev) || isDigit(prev) || (isUpper(prev) && i+1 < len(s) && isLower(s[i+1])) {
+				b.WriteByte('_')
+			}
+		}
+		if isUpper(c) {
+			c += 'a' - 'A'
+		}
+		if !isLower(c) && !isDigit(c) {
+			c = '_'
+		}
+		b.WriteByte(c)
+	}
+	return strings.Trim(multipleUnderscores.ReplaceAllString(b.String(), "_"), "_")
+}
+
+var multipleUnderscores = regexp.MustCompile(`_+`)
+
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+func isLower(c byte) bool { return c >= 'a' && c <= 'z' }
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// sanitizeLabelName is sanitizeMetricName for labels, which may not contain :
+func sanitizeLabelName(name string) string {
+	return strings.ReplaceAll(sanitizeMetricName(name), ":", "_")
+}
+
+// GenericCollector returns the collector of a service without a collector of its own
+func GenericCollector(service string) CollectorFunc {
+	return func(target Target, registry *prometheus.Registry) bool {
+		metrics := NewGenericMetrics(target, service)
+		return register(target, registry, metrics)
+	}
+}
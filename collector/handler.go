@@ -1,8 +1,14 @@
 package collector
 
 import (
+	"context"
+	"fmt"
+	"hadoop_jmx_exporter/config"
+	"hadoop_jmx_exporter/lib"
 	"net/http"
-	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/log"
@@ -11,7 +17,45 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func Handler(w http.ResponseWriter, r *http.Request, logger log.Logger) {
+// Settings are the options of the exporter set by the flags in main.go
+type Settings struct {
+	// allow the Kerberos password in the password query parameter
+	AllowInlineCredentials bool
+	// timeout of a scrape when Prometheus does not send X-Prometheus-Scrape-Timeout-Seconds
+	ScrapeTimeout time.Duration
+	// subtracted from the timeout sent by Prometheus, leaves time to send the response
+	ScrapeTimeoutOffset time.Duration
+	// how long the detected collectors and JMX capabilities of a target are reused, 0 detects on every
+	// scrape
+	DetectionCacheTTL time.Duration
+	// export cumulative JMX values as gauges with the names before they became counters ending in _total
+	LegacyGaugeNames bool
+}
+
+// scrapeTimeout returns how long the scrape may take, the timeout sent by Prometheus minus the offset,
+// capped by the timeout of the module
+func scrapeTimeout(r *http.Request, moduleTimeout time.Duration, settings Settings) (time.Duration, error) {
+	timeout := settings.ScrapeTimeout
+
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse timeout from Prometheus header: %v", err)
+		}
+		timeout = time.Duration(seconds*float64(time.Second)) - settings.ScrapeTimeoutOffset
+		if timeout <= 0 {
+			timeout = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if moduleTimeout > 0 && moduleTimeout < timeout {
+		timeout = moduleTimeout
+	}
+
+	return timeout, nil
+}
+
+func Handler(w http.ResponseWriter, r *http.Request, logger log.Logger, conf *config.Config, settings Settings) {
 
 	params := r.URL.Query()
 
@@ -23,111 +67,259 @@ func Handler(w http.ResponseWriter, r *http.Request, logger log.Logger) {
 		Name: "hadoop_jmx_export_duration_seconds",
 		Help: "Returns how long the exporter took to complete in seconds",
 	})
+	exportErrorGauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hadoop_jmx_export_error_info",
+		Help: "Stage and reason why the export failed",
+	}, []string{"stage", "reason"})
+	collectorSuccessGauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hadoop_jmx_collector_success",
+		Help: "Whether or not each collector was a success",
+	}, []string{"collector"})
+	fetchStatusCodeGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hadoop_jmx_fetch_status_code",
+		Help: "HTTP status code of the last response of the jmx servlet",
+	})
 
-	targetParam := params.Get("target")
-	if targetParam == "" {
+	// params.Get already decoded the target, decoding it again would break a %2F or + in its query
+	target := params.Get("target")
+	if target == "" {
 		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
 		return
 	}
 
-	target, err := url.QueryUnescape(targetParam)
-	if err != nil {
-		http.Error(w, "Error decoding target parameter", http.StatusBadRequest)
-		level.Error(logger).Log("msg", "Error decoding target parameter", "err", err)
-
-		// log.Error("Error decoding target parameter:", err)
-		return
-	}
-
 	t := Target{
-		Url:    target,
-		Logger: logger,
+		Url:      target,
+		Logger:   logger,
+		Settings: settings,
 	}
 
-	KrbPrincipalParam := params.Get("principal")
+	moduleName := params.Get("module")
 
-	if KrbPrincipalParam != "" {
-		KrbPrincipal, err := url.QueryUnescape(KrbPrincipalParam)
+	if moduleName != "" {
+		module, ok := conf.Module(moduleName)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+			level.Error(logger).Log("msg", "Unknown module", "module", moduleName)
+			return
+		}
+
+		KrbPassword, err := conf.ResolvePassword(module.Auth)
 		if err != nil {
-			http.Error(w, "Error decoding principal parameter", http.StatusBadRequest)
-			level.Error(logger).Log("msg", "Error decoding principal parameter", "err", err)
+			http.Error(w, fmt.Sprintf("Error resolving password of module %q", moduleName), http.StatusInternalServerError)
+			level.Error(logger).Log("msg", "Error resolving password", "module", moduleName, "err", err)
+			return
+		}
 
-			// log.Error("Error decoding principal parameter:", err)
+		t.AuthMode = module.Auth.Mode
+		t.User = module.Auth.User
+		if module.Auth.AuthMode() == AuthBasic {
+			t.Password = KrbPassword
 		}
 
-		if KrbPrincipal != "" {
-			t.KrbPrincipal = KrbPrincipal
+		t.KrbAuthMethod = module.Auth.Method
+		t.KrbPrincipal = module.Auth.Principal
+		t.KrbPassword = KrbPassword
+		t.KrbKtPath = module.Auth.KeytabPath
+		t.KrbCCachePath = module.Auth.CCachePath
+		t.Krb5Config = lib.Krb5Config{
+			Path:        module.Kerberos.ConfigFile,
+			Realm:       module.Kerberos.Realm,
+			KDCs:        module.Kerberos.KDCs,
+			DomainRealm: module.Kerberos.DomainRealm,
 		}
+		t.Timeout = module.Timeout
+		t.TLSConfig = &module.TLSConfig
+		if module.Collector != "" {
+			t.ExporterNames = []string{module.Collector}
+		}
+		t.Rules = append(t.Rules, module.Rules...)
 	}
 
-	KrbPasswordParam := params.Get("password")
+	if conf != nil {
+		t.Rules = append(t.Rules, conf.Rules...)
+	}
 
-	if KrbPasswordParam != "" {
-		KrbPassword, err := url.QueryUnescape(KrbPasswordParam)
-		if err != nil {
-			http.Error(w, "Error decoding password parameter", http.StatusBadRequest)
-			level.Error(logger).Log("msg", "Error decoding password parameter", "err", err)
+	collectorParam := params.Get("collector")
+
+	if collectorParam != "" {
+		t.ExporterNames = strings.Split(collectorParam, ",")
+	}
 
-			// log.Error("Error decoding password parameter:", err)
+	// services without a collector are read by the generic collector, only a name that is no service
+	// is a configuration error, detecting instead would hide it
+	for _, name := range t.ExporterNames {
+		if !validServiceName(name) {
+			http.Error(w, fmt.Sprintf("Unknown collector %q", name), http.StatusBadRequest)
+			level.Error(logger).Log("msg", "Unknown collector", "collector", name)
+			return
 		}
+	}
+
+	authParam := params.Get("auth")
 
-		if KrbPassword != "" {
-			t.KrbAuthMethod = "password"
-			t.KrbPassword = KrbPassword
+	if authParam != "" {
+		switch authParam {
+		case AuthNone, AuthSimple, AuthKerberos, AuthBasic:
+			t.AuthMode = authParam
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported auth parameter %q", authParam), http.StatusBadRequest)
+			level.Error(logger).Log("msg", "Unsupported auth parameter", "auth", authParam)
+			return
 		}
 	}
 
-	KrbKtPathParam := params.Get("ktpath")
+	userParam := params.Get("user")
 
-	if KrbKtPathParam != "" {
-		KrbKtPath, err := url.QueryUnescape(KrbKtPathParam)
+	if userParam != "" {
+		t.User = userParam
+	}
 
-		if err != nil {
-			http.Error(w, "Error decoding ktpath parameter", http.StatusBadRequest)
-			level.Error(logger).Log("msg", "Error decoding ktpath parameter", "err", err)
+	// params.Get already decoded the values, decoding them again would turn + and % of a path or a
+	// password into other characters
+	KrbPrincipalParam := params.Get("principal")
 
-			// log.Error("Error decoding ktpath parameter:", err)
-		}
-		if KrbKtPath != "" {
-			t.KrbAuthMethod = "keytab"
-			t.KrbKtPath = KrbKtPath
+	if KrbPrincipalParam != "" {
+		t.KrbPrincipal = KrbPrincipalParam
+	}
+
+	KrbSecretParam := params.Get("secret")
+
+	// the password of kerberos only goes to the KDC, with basic auth anyone able to scrape could send
+	// any secret to a host of their choice, basic auth passwords are only taken from modules
+	if KrbSecretParam != "" && t.AuthMode != "" && t.AuthMode != AuthKerberos {
+		http.Error(w, fmt.Sprintf("Secret parameter is not allowed with auth mode %q, use a module instead", t.AuthMode), http.StatusBadRequest)
+		level.Error(logger).Log("msg", "Refused secret parameter", "secret", KrbSecretParam, "auth", t.AuthMode, "target", target)
+		return
+	}
+
+	if KrbSecretParam != "" {
+		KrbPassword, err := conf.SecretByName(KrbSecretParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error resolving secret %q", KrbSecretParam), http.StatusBadRequest)
+			level.Error(logger).Log("msg", "Error resolving secret", "secret", KrbSecretParam, "err", err)
+			return
 		}
+
+		t.KrbAuthMethod = "password"
+		t.KrbPassword = KrbPassword
+	}
+
+	KrbPasswordParam := params.Get("password")
+
+	if KrbPasswordParam != "" && !settings.AllowInlineCredentials {
+		http.Error(w, "Password parameter is not allowed, use a secret or a module instead", http.StatusForbidden)
+		level.Error(logger).Log("msg", "Refused inline password, start with --allow-inline-credentials to allow it", "target", target)
+		return
+	}
+
+	if KrbPasswordParam != "" {
+		t.KrbAuthMethod = "password"
+		t.KrbPassword = KrbPasswordParam
+	}
+
+	KrbKtPathParam := params.Get("ktpath")
+
+	if KrbKtPathParam != "" {
+		t.KrbAuthMethod = "keytab"
+		t.KrbKtPath = KrbKtPathParam
 	}
 
-	err = t.getCollectorName()
+	KrbCCachePathParam := params.Get("ccache")
 
+	if KrbCCachePathParam != "" {
+		t.KrbAuthMethod = "ccache"
+		t.KrbCCachePath = KrbCCachePathParam
+	}
+
+	timeout, err := scrapeTimeout(r, t.Timeout, settings)
 	if err != nil {
-		exportSuccessGauge.Set(0)
-		level.Error(logger).Log("msg", "Error get collector name", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		level.Error(logger).Log("msg", "Error get scrape timeout", "err", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	t.statusCode = &atomic.Int32{}
+	err = t.getCollectorNames(ctx)
 
+	// the error of a timed out request is often wrapped as text, check the context instead
+	if ctx.Err() == context.DeadlineExceeded {
+		level.Error(logger).Log("msg", "Scrape timed out", "target", target, "timeout", timeout)
+		err = &scrapeError{stage: StageFetch, reason: "timeout", err: ctx.Err()}
+	} else if err != nil {
+		level.Error(logger).Log("msg", "Error get collector name", "err", err)
 	}
 
-	exporter, ok := Collectors[t.ExporterName]
-	if !ok {
-		exportSuccessGauge.Set(0)
-		// http.Error(w, fmt.Sprintf("Unknown exporter %q,  Http StatusText: %s", t.ExporterName, t.RespStatus), http.StatusBadRequest)
+	// the scrape succeeds when the beans were fetched and every collector gathered them without errors
+	success := err == nil
+	if err != nil {
+		exportErrorGauge.WithLabelValues(errorStage(err)).Set(1)
+	}
 
+	statusRegistry := prometheus.NewRegistry()
+	statusRegistry.MustRegister(exportSuccessGauge, exportDurationGauge, exportErrorGauge, collectorSuccessGauge)
+	if code := t.statusCode.Load(); code != 0 {
+		fetchStatusCodeGauge.Set(float64(code))
+		statusRegistry.MustRegister(fetchStatusCodeGauge)
 	}
+	gatherers := prometheus.Gatherers{statusRegistry}
+	var collected prometheus.Gatherers
 
-	start := time.Now()
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(exportSuccessGauge)
-	registry.MustRegister(exportDurationGauge)
+	// a collector set by the module has no beans to read when the fetch failed
+	if success && (len(t.ExporterNames) > 0 || len(t.Rules) > 0) && t.Beans != nil {
+		start := time.Now()
+		level.Info(logger).Log("target", target, "collector", strings.Join(t.ExporterNames, ","))
 
-	if ok {
-		level.Info(logger).Log("target", target, "collector", t.ExporterName)
+		// every service of the process reads the same beans, the JVM and OS metrics are only
+		// exported by the first one
+		for i, name := range t.ExporterNames {
+			t.SkipJvmMetrics = i > 0
+			g, err := gatherCollector(t, name)
+			if err != nil {
+				level.Error(logger).Log("msg", "Error collect metrics", "collector", name, "err", err)
+				exportErrorGauge.WithLabelValues(errorStage(err)).Set(1)
+				collectorSuccessGauge.WithLabelValues(name).Set(0)
+				success = false
+			} else {
+				collectorSuccessGauge.WithLabelValues(name).Set(1)
+			}
+			if g != nil {
+				collected = append(collected, g)
+			}
+		}
+		if len(t.Rules) > 0 {
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(&RulesMetrics{Beans: t.Beans, Rules: t.Rules, Logger: logger})
+			g, err := gathered(registry)
+			if err != nil {
+				level.Error(logger).Log("msg", "Error collect metrics of rules", "err", err)
+				exportErrorGauge.WithLabelValues(errorStage(err)).Set(1)
+				success = false
+			}
+			collected = append(collected, g)
+		}
 
-		success := exporter(t, registry)
-		duration := time.Since(start).Seconds()
-		exportDurationGauge.Set(duration)
-		if success {
-			exportSuccessGauge.Set(1)
-		} else {
-			exportSuccessGauge.Set(0)
+		// the same series from two collectors is only noticed when they are gathered together
+		g, err := gathered(collected)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error merge metrics of collectors", "err", err)
+			exportErrorGauge.WithLabelValues(errorStage(err)).Set(1)
+			success = false
 		}
+		gatherers = append(gatherers, g)
+		exportDurationGauge.Set(time.Since(start).Seconds())
+	} else {
+		success = false
+	}
 
+	if success {
+		exportSuccessGauge.Set(1)
+	} else {
+		exportSuccessGauge.Set(0)
 	}
 
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
 	h.ServeHTTP(w, r)
 }
@@ -1,30 +1,28 @@
 package collector
 
 import (
-	"encoding/json"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/log"
 )
 
 type HiveServer2Metrics struct {
 	BaseMetrics
-	OpenConnectionsCount          prometheus.Gauge
-	JvmPauseExtraSleepTime        prometheus.Gauge
-	OpenOperationsCount           prometheus.Gauge
-	CumulativeConnectionCount     prometheus.Gauge
-	MetastoreHiveLocksCount       prometheus.Gauge
-	ExecAsyncQueueSize            prometheus.Gauge
-	ExecAsyncPoolSize             prometheus.Gauge
-	WaitingCompileOps             prometheus.Gauge
-	HiveTezTasks                  prometheus.Gauge
-	ActiveCallsApiHs2Operation    *prometheus.GaugeVec
-	ActiveCallsApiHs2SqlOperation *prometheus.GaugeVec
-	ApiHs2Operation               *prometheus.GaugeVec
-	ApiHs2SqlOperation            *prometheus.GaugeVec
-	Hs2CompletedOperation         *prometheus.GaugeVec
-	Hs2CompletedSqlOperation      *prometheus.GaugeVec
+	OpenConnectionsCount          *prometheus.Desc
+	JvmPauseExtraSleepTime        *prometheus.Desc
+	OpenOperationsCount           *prometheus.Desc
+	CumulativeConnectionCount     *prometheus.Desc
+	MetastoreHiveLocksCount       *prometheus.Desc
+	ExecAsyncQueueSize            *prometheus.Desc
+	ExecAsyncPoolSize             *prometheus.Desc
+	WaitingCompileOps             *prometheus.Desc
+	HiveTezTasks                  *prometheus.Desc
+	ActiveCallsApiHs2Operation    *prometheus.Desc
+	ActiveCallsApiHs2SqlOperation *prometheus.Desc
+	ApiHs2Operation               *prometheus.Desc
+	ApiHs2SqlOperation            *prometheus.Desc
+	Hs2CompletedOperation         *prometheus.Desc
+	Hs2CompletedSqlOperation      *prometheus.Desc
 }
 
 func NewHiveServer2Metrics(t Target) *HiveServer2Metrics {
@@ -32,191 +30,114 @@ func NewHiveServer2Metrics(t Target) *HiveServer2Metrics {
 	const namespace = "hive_hiveserver2"
 
 	return &HiveServer2Metrics{
-		BaseMetrics: BuildBaseMetrics(t.BodyData, namespace),
-		OpenConnectionsCount: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "open_connections_count",
-			Help:      "open_connections",
-		}),
-		JvmPauseExtraSleepTime: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "jvm",
-			Name:      "pause_extra_sleep_time_count_milliseconds",
-			Help:      "GC 额外睡眠时间",
-		}),
-		OpenOperationsCount: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "open_operations_count",
-			Help:      "open_operations",
-		}),
-		CumulativeConnectionCount: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "cumulative_connection_count",
-			Help:      "累计连接数",
-		}),
-		MetastoreHiveLocksCount: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "metastore_hive_locks",
-			Help:      "metastore_hive_locks",
-		}),
-		ExecAsyncQueueSize: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "exec_async_queue_size",
-			Help:      "hs2 异步操作队列当前大小",
-		}),
-		ExecAsyncPoolSize: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "exec_async_pool_size",
-			Help:      "hs2 异步线程池当前大小",
-		}),
-		WaitingCompileOps: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "waiting_compile_ops",
-			Help:      "waiting_compile_ops",
-		}),
-		HiveTezTasks: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "hive_tez_tasks",
-			Help:      "提交的 Hive on Tez 作业总数",
-		}),
-		ActiveCallsApiHs2Operation: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "active_calls_api_hs2_operation",
-			Help:      "active_calls_api_hs2_operation",
-		}, []string{"state"}),
-		ActiveCallsApiHs2SqlOperation: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "active_calls_api_hs2_sql_operation",
-			Help:      "active_calls_api_hs2_sql_operation",
-		}, []string{"state"}),
-		ApiHs2Operation: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "api_hs2_operation",
-			Help:      "api_hs2_operation",
-		}, []string{"state"}),
-		Hs2CompletedOperation: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "hs2_completed_operation",
-			Help:      "hs2_completed_operation",
-		}, []string{"state"}),
-		Hs2CompletedSqlOperation: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "metrics",
-			Name:      "hs2_completed_sql_operation",
-			Help:      "hs2_completed_sql_operation",
-		}, []string{"state"}),
+		BaseMetrics:                   BuildBaseMetrics(t, namespace),
+		OpenConnectionsCount:          newDesc(namespace, "metrics", "open_connections_count", "open_connections"),
+		JvmPauseExtraSleepTime:        newDesc(namespace, "jvm", "pause_extra_sleep_time_count_milliseconds", "GC 额外睡眠时间"),
+		OpenOperationsCount:           newDesc(namespace, "metrics", "open_operations_count", "open_operations"),
+		CumulativeConnectionCount:     newCounterDesc(t, namespace, "metrics", "cumulative_connection_count", "累计连接数"),
+		MetastoreHiveLocksCount:       newDesc(namespace, "metrics", "metastore_hive_locks", "metastore_hive_locks"),
+		ExecAsyncQueueSize:            newDesc(namespace, "metrics", "exec_async_queue_size", "hs2 异步操作队列当前大小"),
+		ExecAsyncPoolSize:             newDesc(namespace, "metrics", "exec_async_pool_size", "hs2 异步线程池当前大小"),
+		WaitingCompileOps:             newDesc(namespace, "metrics", "waiting_compile_ops", "waiting_compile_ops"),
+		HiveTezTasks:                  newCounterDesc(t, namespace, "metrics", "hive_tez_tasks", "提交的 Hive on Tez 作业总数"),
+		ActiveCallsApiHs2Operation:    newDesc(namespace, "metrics", "active_calls_api_hs2_operation", "active_calls_api_hs2_operation", "state"),
+		ActiveCallsApiHs2SqlOperation: newDesc(namespace, "metrics", "active_calls_api_hs2_sql_operation", "active_calls_api_hs2_sql_operation", "state"),
+		ApiHs2Operation:               newCounterDesc(t, namespace, "metrics", "api_hs2_operation", "api_hs2_operation", "state"),
+		ApiHs2SqlOperation:            newCounterDesc(t, namespace, "metrics", "api_hs2_sql_operation", "api_hs2_sql_operation", "state"),
+		Hs2CompletedOperation:         newCounterDesc(t, namespace, "metrics", "hs2_completed_operation", "hs2_completed_operation", "state"),
+		Hs2CompletedSqlOperation:      newCounterDesc(t, namespace, "metrics", "hs2_completed_sql_operation", "hs2_completed_sql_operation", "state"),
 	}
 }
 
+func (e *HiveServer2Metrics) Describe(ch chan<- *prometheus.Desc) {
+	e.BaseMetrics.Describe(ch)
+	ch <- e.OpenConnectionsCount
+	ch <- e.JvmPauseExtraSleepTime
+	ch <- e.OpenOperationsCount
+	ch <- e.CumulativeConnectionCount
+	ch <- e.MetastoreHiveLocksCount
+	ch <- e.ExecAsyncQueueSize
+	ch <- e.ExecAsyncPoolSize
+	ch <- e.WaitingCompileOps
+	ch <- e.HiveTezTasks
+	ch <- e.ActiveCallsApiHs2Operation
+	ch <- e.ActiveCallsApiHs2SqlOperation
+	ch <- e.ApiHs2Operation
+	ch <- e.ApiHs2SqlOperation
+	ch <- e.Hs2CompletedOperation
+	ch <- e.Hs2CompletedSqlOperation
+}
+
 // Collect implements the prometheus.Collector interface.
 func (e *HiveServer2Metrics) Collect(ch chan<- prometheus.Metric) {
+	// hive has no JvmMetrics bean
+	e.collectGc(ch, "")
 
-	var err error
-
-	var f interface{}
-	err = json.Unmarshal(e.BodyData, &f)
-	if err != nil {
-		log.Error(err)
+	if bean, ok := e.jvmBean("java.lang:type=Memory"); ok {
+		e.collectHeapMemoryUsage(ch, bean)
 	}
-	m := f.(map[string]interface{})
-	var List = m["beans"].([]interface{})
-	for _, Data := range List {
-		DataMap := Data.(map[string]interface{})
-
-		if DataMap["name"] == "java.lang:type=Memory" {
-			heapMemoryUsage := DataMap["HeapMemoryUsage"].(map[string]interface{})
-			e.HeapMemoryUsage.WithLabelValues("committed").Set(heapMemoryUsage["committed"].(float64))
-			e.HeapMemoryUsage.WithLabelValues("init").Set(heapMemoryUsage["init"].(float64))
-			e.HeapMemoryUsage.WithLabelValues("max").Set(heapMemoryUsage["max"].(float64))
-			e.HeapMemoryUsage.WithLabelValues("used").Set(heapMemoryUsage["used"].(float64))
 
-			e.HeapMemoryUsage.Collect(ch)
+	if bean, ok := e.Beans.Get("metrics:name=jvm.pause.extraSleepTime"); ok {
+		collectGauge(ch, e.JvmPauseExtraSleepTime, bean, "Count")
+	}
 
-		}
+	if bean, ok := e.Beans.Get("metrics:name=open_connections"); ok {
+		collectGauge(ch, e.OpenConnectionsCount, bean, "Count")
+	}
 
-		if DataMap["name"] == "metrics:name=jvm.pause.extraSleepTime" {
-			e.JvmPauseExtraSleepTime.Set(DataMap["Count"].(float64))
-			e.JvmPauseExtraSleepTime.Collect(ch)
-		}
+	if bean, ok := e.Beans.Get("metrics:name=open_operations"); ok {
+		collectGauge(ch, e.OpenOperationsCount, bean, "Count")
+	}
 
-		if DataMap["name"] == "metrics:name=open_connections" {
-			e.OpenConnectionsCount.Set(DataMap["Count"].(float64))
-			e.OpenConnectionsCount.Collect(ch)
-		}
+	if bean, ok := e.Beans.Get("metrics:name=cumulative_connection_count"); ok {
+		e.collectCounter(ch, e.CumulativeConnectionCount, bean, "Count")
+	}
 
-		if DataMap["name"] == "metrics:name=open_operations" {
-			e.OpenOperationsCount.Set(DataMap["Count"].(float64))
-			e.OpenOperationsCount.Collect(ch)
-		}
+	if bean, ok := e.Beans.Get("metrics:name=metastore_hive_locks"); ok {
+		collectGauge(ch, e.MetastoreHiveLocksCount, bean, "Count")
+	}
 
-		if DataMap["name"] == "cumulative_connection_count" {
-			e.CumulativeConnectionCount.Set(DataMap["Count"].(float64))
-			e.CumulativeConnectionCount.Collect(ch)
-		}
+	if bean, ok := e.Beans.Get("metrics:name=exec_async_queue_size"); ok {
+		collectGauge(ch, e.ExecAsyncQueueSize, bean, "Value")
+	}
 
-		if DataMap["name"] == "metrics:name=metastore_hive_locks" {
-			e.MetastoreHiveLocksCount.Set(DataMap["Count"].(float64))
-			e.MetastoreHiveLocksCount.Collect(ch)
-		}
+	if bean, ok := e.Beans.Get("metrics:name=exec_async_pool_size"); ok {
+		collectGauge(ch, e.ExecAsyncPoolSize, bean, "Value")
+	}
+	if bean, ok := e.Beans.Get("metrics:name=waiting_compile_ops"); ok {
+		collectGauge(ch, e.WaitingCompileOps, bean, "Count")
+	}
+	if bean, ok := e.Beans.Get("metrics:name=hive_tez_tasks"); ok {
+		e.collectCounter(ch, e.HiveTezTasks, bean, "Count")
+	}
 
-		if DataMap["name"] == "metrics:name=exec_async_queue_size" {
-			e.ExecAsyncQueueSize.Set(DataMap["Value"].(float64))
-			e.ExecAsyncQueueSize.Collect(ch)
-		}
+	for _, bean := range e.Beans.Beans() {
 
-		if DataMap["name"] == "metrics:name=exec_async_pool_size" {
-			e.ExecAsyncPoolSize.Set(DataMap["Value"].(float64))
-			e.ExecAsyncPoolSize.Collect(ch)
-		}
-		if DataMap["name"] == "metrics:name=waiting_compile_ops" {
-			e.WaitingCompileOps.Set(DataMap["Count"].(float64))
-			e.WaitingCompileOps.Collect(ch)
+		if strings.HasPrefix(bean.Name(), "metrics:name=active_calls_api_hs2_operation_") {
+			state := strings.ToLower(getLastUpperWithDelimiter(bean.Name(), "_"))
+			collectGauge(ch, e.ActiveCallsApiHs2Operation, bean, "Count", state)
 		}
-		if DataMap["name"] == "metrics:name=hive_tez_tasks" {
-			e.HiveTezTasks.Set(DataMap["Count"].(float64))
-			e.HiveTezTasks.Collect(ch)
+		if strings.HasPrefix(bean.Name(), "metrics:name=active_calls_api_hs2_sql_operation_") {
+			state := strings.ToLower(getLastUpperWithDelimiter(bean.Name(), "_"))
+			collectGauge(ch, e.ActiveCallsApiHs2SqlOperation, bean, "Count", state)
 		}
-
-		if strings.HasPrefix(DataMap["name"].(string), "metrics:name=active_calls_api_hs2_operation_") {
-			state := strings.ToLower(getLastUpperWithDelimiter(DataMap["name"].(string), "_"))
-			e.ActiveCallsApiHs2Operation.WithLabelValues(state).Set(DataMap["Count"].(float64))
-		}
-		if strings.HasPrefix(DataMap["name"].(string), "metrics:name=active_calls_api_hs2_sql_operation_") {
-			state := strings.ToLower(getLastUpperWithDelimiter(DataMap["name"].(string), "_"))
-			e.ActiveCallsApiHs2SqlOperation.WithLabelValues(state).Set(DataMap["Count"].(float64))
+		if strings.HasPrefix(bean.Name(), "metrics:name=api_hs2_operation_") {
+			state := strings.ToLower(getLastUpperWithDelimiter(bean.Name(), "_"))
+			e.collectCounter(ch, e.ApiHs2Operation, bean, "Count", state)
 		}
-		if strings.HasPrefix(DataMap["name"].(string), "metrics:name=api_hs2_sql_operation_") {
-			state := strings.ToLower(getLastUpperWithDelimiter(DataMap["name"].(string), "_"))
-			e.ApiHs2SqlOperation.WithLabelValues(state).Set(DataMap["Count"].(float64))
+		if strings.HasPrefix(bean.Name(), "metrics:name=api_hs2_sql_operation_") {
+			state := strings.ToLower(getLastUpperWithDelimiter(bean.Name(), "_"))
+			e.collectCounter(ch, e.ApiHs2SqlOperation, bean, "Count", state)
 		}
-		if strings.HasPrefix(DataMap["name"].(string), "metrics:name=hs2_completed_operation_") {
-			state := strings.ToLower(getLastUpperWithDelimiter(DataMap["name"].(string), "_"))
-			e.Hs2CompletedOperation.WithLabelValues(state).Set(DataMap["Count"].(float64))
+		if strings.HasPrefix(bean.Name(), "metrics:name=hs2_completed_operation_") {
+			state := strings.ToLower(getLastUpperWithDelimiter(bean.Name(), "_"))
+			e.collectCounter(ch, e.Hs2CompletedOperation, bean, "Count", state)
 		}
-		if strings.HasPrefix(DataMap["name"].(string), "metrics:name=hs2_completed_sql_operation_") {
-			state := strings.ToLower(getLastUpperWithDelimiter(DataMap["name"].(string), "_"))
-			e.Hs2CompletedSqlOperation.WithLabelValues(state).Set(DataMap["Count"].(float64))
+		if strings.HasPrefix(bean.Name(), "metrics:name=hs2_completed_sql_operation_") {
+			state := strings.ToLower(getLastUpperWithDelimiter(bean.Name(), "_"))
+			e.collectCounter(ch, e.Hs2CompletedSqlOperation, bean, "Count", state)
 		}
-
 	}
-	e.ActiveCallsApiHs2Operation.Collect(ch)
-	e.ActiveCallsApiHs2SqlOperation.Collect(ch)
-	e.ApiHs2SqlOperation.Collect(ch)
-	e.Hs2CompletedOperation.Collect(ch)
-	e.Hs2CompletedSqlOperation.Collect(ch)
-
 }
 
 func getLastUpperWithDelimiter(s string, delimiter string) string {
@@ -232,10 +153,13 @@ func getLastUpperWithDelimiter(s string, delimiter string) string {
 	return ""
 }
 
+// beans read by HiveServer2Collector, see Target.fetchBeans
+var hiveServer2Queries = []string{
+	"metrics:*",
+}
+
 func HiveServer2Collector(target Target, registry *prometheus.Registry) (success bool) {
 
 	metrics := NewHiveServer2Metrics(target)
-	registry.MustRegister(metrics)
-
-	return true
+	return register(target, registry, metrics)
 }
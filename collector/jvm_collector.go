@@ -0,0 +1,267 @@
+package collector
+
+import (
+	"strings"
+
+	"hadoop_jmx_exporter/jmx"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JvmMetrics exports the JVM every role runs in: heap and non-heap usage, the memory pools, the buffer
+// pools, the last GC of each garbage collector, threads, classes, runtime, compilation, the operating
+// system and the thread states, log counters and pause monitor of the Hadoop JvmMetrics bean. It is
+// registered with the first collector of a process, whose name is the role label, see gatherCollector
+type JvmMetrics struct {
+	OsMetrics
+	Beans                     *BeanIndex
+	Role                      string
+	MemoryUsage               *prometheus.Desc
+	MemoryPoolUsage           *prometheus.Desc
+	MemoryPoolPeakUsage       *prometheus.Desc
+	MemoryPoolCollectionUsage *prometheus.Desc
+	BufferPoolCount           *prometheus.Desc
+	BufferPoolMemoryUsed      *prometheus.Desc
+	BufferPoolTotalCapacity   *prometheus.Desc
+	LastGcDuration            *prometheus.Desc
+	ThreadCount               *prometheus.Desc
+	PeakThreadCount           *prometheus.Desc
+	DaemonThreadCount         *prometheus.Desc
+	TotalStartedThreadCount   *prometheus.Desc
+	ThreadStateCount          *prometheus.Desc
+	LoadedClassCount          *prometheus.Desc
+	TotalLoadedClassCount     *prometheus.Desc
+	UnloadedClassCount        *prometheus.Desc
+	StartTime                 *prometheus.Desc
+	Uptime                    *prometheus.Desc
+	RuntimeInfo               *prometheus.Desc
+	TotalCompilationTime      *prometheus.Desc
+	LogCount                  *prometheus.Desc
+	PauseThresholdExceeded    *prometheus.Desc
+	PauseExtraSleepTime       *prometheus.Desc
+	GcTimePercentage          *prometheus.Desc
+}
+
+func NewJvmMetrics(t Target, role string) *JvmMetrics {
+
+	const namespace = "hadoop"
+	return &JvmMetrics{
+		OsMetrics:                 BuildOsMetrics(t),
+		Beans:                     t.Beans,
+		Role:                      role,
+		MemoryUsage:               newDesc(namespace, "jvm", "memory_usage_bytes", "Current heap and non-heap memory of each mode in bytes", "role", "area", "mode"),
+		MemoryPoolUsage:           newDesc(namespace, "jvm", "memory_pool_usage_bytes", "Current memory of each pool and mode in bytes", "role", "pool", "mode"),
+		MemoryPoolPeakUsage:       newDesc(namespace, "jvm", "memory_pool_peak_usage_bytes", "Peak memory of each pool and mode in bytes since the JVM started", "role", "pool", "mode"),
+		MemoryPoolCollectionUsage: newDesc(namespace, "jvm", "memory_pool_collection_usage_bytes", "Memory of each pool and mode in bytes after the last GC", "role", "pool", "mode"),
+		BufferPoolCount:           newDesc(namespace, "jvm", "buffer_pool_count", "Current number of buffers of each pool", "role", "pool"),
+		BufferPoolMemoryUsed:      newDesc(namespace, "jvm", "buffer_pool_memory_used_bytes", "Current memory used by the buffers of each pool in bytes", "role", "pool"),
+		BufferPoolTotalCapacity:   newDesc(namespace, "jvm", "buffer_pool_total_capacity_bytes", "Current total capacity of the buffers of each pool in bytes", "role", "pool"),
+		LastGcDuration:            newDesc(namespace, "jvm", "last_gc_duration_milliseconds", "Duration of the last GC of each garbage collector in milliseconds", "role", "type"),
+		ThreadCount:               newDesc(namespace, "jvm", "thread_count", "Current number of live threads", "role"),
+		PeakThreadCount:           newDesc(namespace, "jvm", "thread_peak_count", "Peak number of live threads since the JVM started", "role"),
+		DaemonThreadCount:         newDesc(namespace, "jvm", "thread_daemon_count", "Current number of live daemon threads", "role"),
+		TotalStartedThreadCount:   newCounterDesc(t, namespace, "jvm", "thread_started", "Total number of threads started", "role"),
+		ThreadStateCount:          newDesc(namespace, "jvm", "thread_state_count", "Current number of threads of each state", "role", "state"),
+		LoadedClassCount:          newDesc(namespace, "jvm", "class_loaded_count", "Current number of loaded classes", "role"),
+		TotalLoadedClassCount:     newCounterDesc(t, namespace, "jvm", "class_loaded", "Total number of classes loaded", "role"),
+		UnloadedClassCount:        newCounterDesc(t, namespace, "jvm", "class_unloaded", "Total number of classes unloaded", "role"),
+		StartTime:                 newDesc(namespace, "jvm", "start_time_seconds", "Start time of the JVM since unix epoch in seconds", "role"),
+		Uptime:                    newDesc(namespace, "jvm", "uptime_seconds", "Uptime of the JVM in seconds", "role"),
+		RuntimeInfo:               newDesc(namespace, "jvm", "runtime_info", "Name, vendor and version of the JVM", "role", "vm_name", "vm_vendor", "vm_version", "spec_version"),
+		TotalCompilationTime:      newCounterDesc(t, namespace, "jvm", "compilation_time_milliseconds", "Total time spent in JIT compilation in milliseconds", "role"),
+		LogCount:                  newCounterDesc(t, namespace, "jvm", "log_count", "Total number of log events of each level", "role", "level"),
+		PauseThresholdExceeded:    newCounterDesc(t, namespace, "jvm", "pause_threshold_exceeded", "Total number of JVM pauses longer than the info or warn threshold of the pause monitor", "role", "level"),
+		PauseExtraSleepTime:       newCounterDesc(t, namespace, "jvm", "pause_extra_sleep_time_milliseconds", "Total time in milliseconds the pause monitor slept longer than expected", "role"),
+		GcTimePercentage:          newDesc(namespace, "jvm", "gc_time_percentage", "Percentage of time spent in GC in the observation window of the GC time monitor", "role"),
+	}
+}
+
+func (e *JvmMetrics) Describe(ch chan<- *prometheus.Desc) {
+	e.OsMetrics.Describe(ch)
+	ch <- e.MemoryUsage
+	ch <- e.MemoryPoolUsage
+	ch <- e.MemoryPoolPeakUsage
+	ch <- e.MemoryPoolCollectionUsage
+	ch <- e.BufferPoolCount
+	ch <- e.BufferPoolMemoryUsed
+	ch <- e.BufferPoolTotalCapacity
+	ch <- e.LastGcDuration
+	ch <- e.ThreadCount
+	ch <- e.PeakThreadCount
+	ch <- e.DaemonThreadCount
+	ch <- e.TotalStartedThreadCount
+	ch <- e.ThreadStateCount
+	ch <- e.LoadedClassCount
+	ch <- e.TotalLoadedClassCount
+	ch <- e.UnloadedClassCount
+	ch <- e.StartTime
+	ch <- e.Uptime
+	ch <- e.RuntimeInfo
+	ch <- e.TotalCompilationTime
+	ch <- e.LogCount
+	ch <- e.PauseThresholdExceeded
+	ch <- e.PauseExtraSleepTime
+	ch <- e.GcTimePercentage
+}
+
+var (
+	memoryPoolPattern, _ = jmx.ParseObjectNamePattern("java.lang:type=MemoryPool,*")
+	bufferPoolPattern, _ = jmx.ParseObjectNamePattern("java.nio:type=BufferPool,*")
+	jvmMetricsPattern, _ = jmx.ParseObjectNamePattern("Hadoop:service=*,name=JvmMetrics")
+)
+
+// Collect implements the prometheus.Collector interface.
+func (e *JvmMetrics) Collect(ch chan<- prometheus.Metric) {
+	if bean, ok := e.Beans.Get("java.lang:type=Memory"); ok {
+		if usage, ok := bean.object("HeapMemoryUsage"); ok {
+			collectMemoryUsage(ch, e.MemoryUsage, usage, e.Role, "heap")
+		}
+		if usage, ok := bean.object("NonHeapMemoryUsage"); ok {
+			collectMemoryUsage(ch, e.MemoryUsage, usage, e.Role, "nonheap")
+		}
+	}
+
+	// {"name":"java.lang:type=MemoryPool,name=G1 Eden Space", "Usage":{"committed":100, "init":100, "max":-1, "used":50}, "CollectionUsage":null, ...}
+	for _, bean := range e.Beans.Match(memoryPoolPattern) {
+		pool := beanNameProp(bean)
+		if pool == "" {
+			continue
+		}
+		if usage, ok := bean.object("Usage"); ok {
+			collectMemoryUsage(ch, e.MemoryPoolUsage, usage, e.Role, pool)
+		}
+		if usage, ok := bean.object("PeakUsage"); ok {
+			collectMemoryUsage(ch, e.MemoryPoolPeakUsage, usage, e.Role, pool)
+		}
+		// null for the pools no garbage collector manages, like Metaspace
+		if usage, err := bean.Map("CollectionUsage"); err == nil {
+			collectMemoryUsage(ch, e.MemoryPoolCollectionUsage, usage, e.Role, pool)
+		}
+	}
+
+	for _, bean := range e.Beans.Match(bufferPoolPattern) {
+		pool := beanNameProp(bean)
+		if pool == "" {
+			continue
+		}
+		collectGauge(ch, e.BufferPoolCount, bean, "Count", e.Role, pool)
+		collectGauge(ch, e.BufferPoolMemoryUsed, bean, "MemoryUsed", e.Role, pool)
+		collectGauge(ch, e.BufferPoolTotalCapacity, bean, "TotalCapacity", e.Role, pool)
+	}
+
+	for _, bean := range e.Beans.Match(gcPattern) {
+		gc := beanNameProp(bean)
+		if gc == "" {
+			continue
+		}
+		// null until the garbage collector ran once
+		if info, err := bean.Map("LastGcInfo"); err == nil {
+			collectGauge(ch, e.LastGcDuration, info, "duration", e.Role, gc)
+		}
+	}
+
+	if bean, ok := e.Beans.Get("java.lang:type=Threading"); ok {
+		collectGauge(ch, e.ThreadCount, bean, "ThreadCount", e.Role)
+		collectGauge(ch, e.PeakThreadCount, bean, "PeakThreadCount", e.Role)
+		collectGauge(ch, e.DaemonThreadCount, bean, "DaemonThreadCount", e.Role)
+		e.collectCounter(ch, e.TotalStartedThreadCount, bean, "TotalStartedThreadCount", e.Role)
+	}
+
+	if bean, ok := e.Beans.Get("java.lang:type=ClassLoading"); ok {
+		collectGauge(ch, e.LoadedClassCount, bean, "LoadedClassCount", e.Role)
+		e.collectCounter(ch, e.TotalLoadedClassCount, bean, "TotalLoadedClassCount", e.Role)
+		e.collectCounter(ch, e.UnloadedClassCount, bean, "UnloadedClassCount", e.Role)
+	}
+
+	if bean, ok := e.Beans.Get("java.lang:type=Runtime"); ok {
+		// StartTime and Uptime are milliseconds, seconds compare with time() to detect restarts
+		if v, ok := bean.float("StartTime"); ok {
+			ch <- prometheus.MustNewConstMetric(e.StartTime, prometheus.GaugeValue, v/1000, e.Role)
+		}
+		if v, ok := bean.float("Uptime"); ok {
+			ch <- prometheus.MustNewConstMetric(e.Uptime, prometheus.GaugeValue, v/1000, e.Role)
+		}
+		vmName, ok1 := bean.string("VmName")
+		vmVendor, ok2 := bean.string("VmVendor")
+		vmVersion, ok3 := bean.string("VmVersion")
+		specVersion, ok4 := bean.string("SpecVersion")
+		if ok1 && ok2 && ok3 && ok4 {
+			ch <- prometheus.MustNewConstMetric(e.RuntimeInfo, prometheus.GaugeValue, 1, e.Role, vmName, vmVendor, vmVersion, specVersion)
+		}
+	}
+
+	if bean, ok := e.Beans.Get("java.lang:type=Compilation"); ok {
+		e.collectCounter(ch, e.TotalCompilationTime, bean, "TotalCompilationTime", e.Role)
+	}
+
+	if bean, ok := e.Beans.Get("java.lang:type=OperatingSystem"); ok {
+		e.OsMetrics.collect(ch, bean, e.Role)
+	}
+
+	if bean, ok := e.jvmMetricsBean(); ok {
+		for _, state := range []string{"New", "Runnable", "Blocked", "Waiting", "TimedWaiting", "Terminated"} {
+			collectGauge(ch, e.ThreadStateCount, bean, "Threads"+state, e.Role, snakeCase(state))
+		}
+		for _, level := range []string{"Fatal", "Error", "Warn", "Info"} {
+			e.collectCounter(ch, e.LogCount, bean, "Log"+level, e.Role, strings.ToLower(level))
+		}
+
+		// JvmPauseMonitor
+		e.collectCounter(ch, e.PauseThresholdExceeded, bean, "GcNumInfoThresholdExceeded", e.Role, "info")
+		e.collectCounter(ch, e.PauseThresholdExceeded, bean, "GcNumWarnThresholdExceeded", e.Role, "warn")
+		e.collectCounter(ch, e.PauseExtraSleepTime, bean, "GcTotalExtraSleepTime", e.Role)
+		// only with dfs.namenode.gc.time.monitor.enable and friends
+		if v, err := bean.Float("GcTimePercentage"); err == nil {
+			ch <- prometheus.MustNewConstMetric(e.GcTimePercentage, prometheus.GaugeValue, v, e.Role)
+		}
+	}
+
+	// the JvmPauseMonitor of hive counts in metrics:name=jvm.pause.* beans
+	if bean, ok := e.Beans.Get("metrics:name=jvm.pause.info-threshold"); ok {
+		e.collectCounter(ch, e.PauseThresholdExceeded, bean, "Count", e.Role, "info")
+	}
+	if bean, ok := e.Beans.Get("metrics:name=jvm.pause.warn-threshold"); ok {
+		e.collectCounter(ch, e.PauseThresholdExceeded, bean, "Count", e.Role, "warn")
+	}
+	if bean, ok := e.Beans.Get("metrics:name=jvm.pause.extraSleepTime"); ok {
+		e.collectCounter(ch, e.PauseExtraSleepTime, bean, "Count", e.Role)
+	}
+}
+
+// jvmMetricsBean returns the Hadoop:service=<service>,name=JvmMetrics bean of the process, the one of
+// the role when services like HBase register more than one
+func (e *JvmMetrics) jvmMetricsBean() (Bean, bool) {
+	if bean, ok := e.Beans.Get("Hadoop:service=" + e.Role + ",name=JvmMetrics"); ok {
+		return bean, true
+	}
+	beans := e.Beans.Match(jvmMetricsPattern)
+	if len(beans) == 0 {
+		return Bean{}, false
+	}
+	return beans[0], true
+}
+
+// collectMemoryUsage sends the committed, init, max and used fields of a MemoryUsage attribute, the
+// mode label follows labels
+func collectMemoryUsage(ch chan<- prometheus.Metric, desc *prometheus.Desc, usage Bean, labels ...string) {
+	for _, mode := range []string{"committed", "init", "max", "used"} {
+		collectGauge(ch, desc, usage, mode, append(labels[:len(labels):len(labels)], mode)...)
+	}
+}
+
+// beanNameProp returns the name key property of a bean like java.lang:type=MemoryPool,name=Metaspace
+func beanNameProp(bean Bean) string {
+	o, ok := bean.ObjectName()
+	if !ok {
+		return ""
+	}
+	return strings.Trim(o.Props["name"], `"`)
+}
+
+// beans read by JvmMetrics, fetched with the ones of the collectors. Each query is a request of its
+// own, so all java.lang beans are read at once, they are small next to the beans of a service. The
+// JvmMetrics bean is in the queries of each collector and the jvm.pause beans of hive in metrics:*
+var jvmQueries = []string{
+	"java.lang:*",
+	"java.nio:type=BufferPool,*",
+}
@@ -1,139 +1,225 @@
 package collector
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"strings"
+
+	"hadoop_jmx_exporter/jmx"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newDesc returns the desc of the metric namespace_subsystem_name
+func newDesc(namespace string, subsystem string, name string, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, labels, nil)
+}
+
+// newCounterDesc is newDesc for cumulative JMX values like GC counts or received bytes, they are
+// counters named <name>_total, or gauges named <name> with Settings.LegacyGaugeNames
+func newCounterDesc(t Target, namespace string, subsystem string, name string, help string, labels ...string) *prometheus.Desc {
+	if !t.Settings.LegacyGaugeNames {
+		name += "_total"
+	}
+	return newDesc(namespace, subsystem, name, help, labels...)
+}
+
+// counters is embedded by the metrics with descs of newCounterDesc, to send their values with the
+// matching type
+type counters struct {
+	legacyGaugeNames bool
+}
+
+func newCounters(t Target) counters {
+	return counters{legacyGaugeNames: t.Settings.LegacyGaugeNames}
+}
+
+// counterValueType is the type of the metrics of newCounterDesc
+func (c counters) counterValueType() prometheus.ValueType {
+	if c.legacyGaugeNames {
+		return prometheus.GaugeValue
+	}
+	return prometheus.CounterValue
+}
 
 type BaseMetrics struct {
-	BodyData        []byte
-	GcCount         *prometheus.GaugeVec
-	GcTime          *prometheus.GaugeVec
-	HeapMemoryUsage *prometheus.GaugeVec
+	counters
+	Beans *BeanIndex
+	// see Target.SkipJvmMetrics
+	SkipJvmMetrics  bool
+	GcCount         *prometheus.Desc
+	GcTime          *prometheus.Desc
+	HeapMemoryUsage *prometheus.Desc
 }
 
+// Describe sends the descs of the JVM metrics, none when another collector of the process exports them
 func (e *BaseMetrics) Describe(ch chan<- *prometheus.Desc) {
-
+	if e.SkipJvmMetrics {
+		return
+	}
+	ch <- e.GcCount
+	ch <- e.GcTime
+	ch <- e.HeapMemoryUsage
 }
 
-func BuildBaseMetrics(bodydata []byte, namespace string) BaseMetrics {
+func BuildBaseMetrics(t Target, namespace string) BaseMetrics {
 	return BaseMetrics{
-		BodyData: bodydata,
-		HeapMemoryUsage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "memory",
-			Name:      "heap_memory_usage_bytes",
-			Help:      "Current heap memory of each mode in bytes",
-		}, []string{"mode"}),
-		GcCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "jvm_metrics",
-			Name:      "gc_count",
-			Help:      "GC count of each type",
-		}, []string{"type"}),
-		GcTime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "jvm_metrics",
-			Name:      "gc_time_milliseconds",
-			Help:      "GC time of each type in milliseconds",
-		}, []string{"type"}),
+		counters:        newCounters(t),
+		Beans:           t.Beans,
+		SkipJvmMetrics:  t.SkipJvmMetrics,
+		HeapMemoryUsage: newDesc(namespace, "memory", "heap_memory_usage_bytes", "Current heap memory of each mode in bytes", "mode"),
+		GcCount:         newCounterDesc(t, namespace, "jvm_metrics", "gc_count", "GC count of each type", "type"),
+		GcTime:          newCounterDesc(t, namespace, "jvm_metrics", "gc_time_milliseconds", "GC time of each type in milliseconds", "type"),
 	}
 }
 
+// OsMetrics are the metrics of the java.lang:type=OperatingSystem bean, exported once per process by
+// JvmMetrics with the role label so the processes of a host can be compared
 type OsMetrics struct {
-	OpenFileDescriptorCount    prometheus.Gauge
-	MaxFileDescriptorCount     prometheus.Gauge
-	CommittedVirtualMemorySize prometheus.Gauge
-	TotalSwapSpaceSize         prometheus.Gauge
-	FreeSwapSpaceSize          prometheus.Gauge
-	ProcessCpuTime             prometheus.Gauge
-	FreePhysicalMemorySize     prometheus.Gauge
-	TotalPhysicalMemorySize    prometheus.Gauge
-	SystemCpuLoad              prometheus.Gauge
-	ProcessCpuLoad             prometheus.Gauge
-	AvailableProcessors        prometheus.Gauge
-	SystemLoadAverage          prometheus.Gauge
-	OsUnameInfo                *prometheus.GaugeVec
+	counters
+	OpenFileDescriptorCount    *prometheus.Desc
+	MaxFileDescriptorCount     *prometheus.Desc
+	CommittedVirtualMemorySize *prometheus.Desc
+	TotalSwapSpaceSize         *prometheus.Desc
+	FreeSwapSpaceSize          *prometheus.Desc
+	ProcessCpuTime             *prometheus.Desc
+	// the nanoseconds gauge ProcessCpuTime replaced, still exported with --compat.legacy-gauge-names
+	LegacyProcessCpuTime    *prometheus.Desc
+	FreePhysicalMemorySize  *prometheus.Desc
+	TotalPhysicalMemorySize *prometheus.Desc
+	SystemCpuLoad           *prometheus.Desc
+	ProcessCpuLoad          *prometheus.Desc
+	AvailableProcessors     *prometheus.Desc
+	SystemLoadAverage       *prometheus.Desc
+	OsUnameInfo             *prometheus.Desc
 }
 
-func BuildOsMetrics() OsMetrics {
+func BuildOsMetrics(t Target) OsMetrics {
 	const namespace = "hadoop"
 	return OsMetrics{
-		OpenFileDescriptorCount: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "open_fds_count",
-			Help:      "",
-		}),
-		MaxFileDescriptorCount: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "max_fds_count",
-			Help:      "",
-		}),
-		CommittedVirtualMemorySize: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "committed_virtual_memory_size_bytes",
-			Help:      "",
-		}),
-		TotalSwapSpaceSize: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "total_swap_space_size_bytes",
-			Help:      "",
-		}),
-		FreeSwapSpaceSize: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "free_swap_space_size_bytes",
-			Help:      "",
-		}),
-		ProcessCpuTime: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "process_cpu_time",
-			Help:      "",
-		}),
-		FreePhysicalMemorySize: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "free_physical_memory_size_bytes",
-			Help:      "",
-		}),
-		TotalPhysicalMemorySize: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "total_physical_memory_size_bytes",
-			Help:      "",
-		}),
-		SystemCpuLoad: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "system_cpu_load",
-			Help:      "",
-		}),
-		ProcessCpuLoad: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "process_cpu_load",
-			Help:      "",
-		}),
-		AvailableProcessors: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "available_processors",
-			Help:      "",
-		}),
-		SystemLoadAverage: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "system_load_average",
-			Help:      "",
-		}),
-		OsUnameInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: "os",
-			Name:      "info",
-			Help:      "",
-		}, []string{"arch", "name", "version"}),
+		counters:                   newCounters(t),
+		OpenFileDescriptorCount:    newDesc(namespace, "os", "open_fds_count", "", "role"),
+		MaxFileDescriptorCount:     newDesc(namespace, "os", "max_fds_count", "", "role"),
+		CommittedVirtualMemorySize: newDesc(namespace, "os", "committed_virtual_memory_size_bytes", "", "role"),
+		TotalSwapSpaceSize:         newDesc(namespace, "os", "total_swap_space_size_bytes", "", "role"),
+		FreeSwapSpaceSize:          newDesc(namespace, "os", "free_swap_space_size_bytes", "", "role"),
+		ProcessCpuTime:             newCounterDesc(t, namespace, "os", "process_cpu_seconds", "Total CPU time used by the process in seconds", "role"),
+		LegacyProcessCpuTime:       newDesc(namespace, "os", "process_cpu_time", "", "role"),
+		FreePhysicalMemorySize:     newDesc(namespace, "os", "free_physical_memory_size_bytes", "", "role"),
+		TotalPhysicalMemorySize:    newDesc(namespace, "os", "total_physical_memory_size_bytes", "", "role"),
+		SystemCpuLoad:              newDesc(namespace, "os", "system_cpu_load", "", "role"),
+		ProcessCpuLoad:             newDesc(namespace, "os", "process_cpu_load", "", "role"),
+		AvailableProcessors:        newDesc(namespace, "os", "available_processors", "", "role"),
+		SystemLoadAverage:          newDesc(namespace, "os", "system_load_average", "", "role"),
+		OsUnameInfo:                newDesc(namespace, "os", "info", "", "role", "arch", "name", "version"),
 	}
+}
+
+func (e *OsMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.OpenFileDescriptorCount
+	ch <- e.MaxFileDescriptorCount
+	ch <- e.CommittedVirtualMemorySize
+	ch <- e.TotalSwapSpaceSize
+	ch <- e.FreeSwapSpaceSize
+	ch <- e.ProcessCpuTime
+	if e.legacyGaugeNames {
+		ch <- e.LegacyProcessCpuTime
+	}
+	ch <- e.FreePhysicalMemorySize
+	ch <- e.TotalPhysicalMemorySize
+	ch <- e.SystemCpuLoad
+	ch <- e.ProcessCpuLoad
+	ch <- e.AvailableProcessors
+	ch <- e.SystemLoadAverage
+	ch <- e.OsUnameInfo
+}
 
+// jvmBean returns a bean of the JVM like java.lang:type=Memory, none when another collector of the
+// process exports the JVM metrics
+func (e *BaseMetrics) jvmBean(name string) (Bean, bool) {
+	if e.SkipJvmMetrics {
+		return Bean{}, false
+	}
+	return e.Beans.Get(name)
+}
+
+// gcPattern matches the java.lang:type=GarbageCollector,name=<collector> bean of each garbage collector
+var gcPattern, _ = jmx.ParseObjectNamePattern("java.lang:type=GarbageCollector,*")
+
+// collectGc sends the count and time of every garbage collector with its name as the type label, read
+// from the GcCount<collector> and GcTimeMillis<collector> attributes of the JvmMetrics bean of the
+// service and from the java.lang:type=GarbageCollector beans, so G1, ZGC, Shenandoah and Parallel are
+// exported like ParNew and ConcurrentMarkSweep. jvmMetrics is empty for services without JvmMetrics
+func (e *BaseMetrics) collectGc(ch chan<- prometheus.Metric, jvmMetrics string) {
+	if e.SkipJvmMetrics {
+		return
+	}
+
+	counts := map[string]bool{}
+	times := map[string]bool{}
+	if bean, ok := e.Beans.Get(jvmMetrics); ok && jvmMetrics != "" {
+		// GcCount and GcTimeMillis without a collector are the sums
+		for _, attr := range bean.Numbers() {
+			if gc, ok := strings.CutPrefix(attr.Name, "GcCount"); ok && gc != "" {
+				ch <- prometheus.MustNewConstMetric(e.GcCount, e.counterValueType(), attr.Value, gc)
+				counts[gc] = true
+			}
+			if gc, ok := strings.CutPrefix(attr.Name, "GcTimeMillis"); ok && gc != "" {
+				ch <- prometheus.MustNewConstMetric(e.GcTime, e.counterValueType(), attr.Value, gc)
+				times[gc] = true
+			}
+		}
+	}
+
+	for _, bean := range e.Beans.Match(gcPattern) {
+		gc := beanNameProp(bean)
+		if gc == "" {
+			continue
+		}
+		if !counts[gc] {
+			e.collectCounter(ch, e.GcCount, bean, "CollectionCount", gc)
+		}
+		if !times[gc] {
+			e.collectCounter(ch, e.GcTime, bean, "CollectionTime", gc)
+		}
+	}
+}
+
+// collectHeapMemoryUsage sends HeapMemoryUsage of the java.lang:type=Memory bean to ch
+func (e *BaseMetrics) collectHeapMemoryUsage(ch chan<- prometheus.Metric, b Bean) {
+	heapMemoryUsage, ok := b.object("HeapMemoryUsage")
+	if !ok {
+		return
+	}
+	for _, mode := range []string{"committed", "init", "max", "used"} {
+		collectGauge(ch, e.HeapMemoryUsage, heapMemoryUsage, mode, mode)
+	}
+}
+
+// collect sends the metrics of the java.lang:type=OperatingSystem bean of the process of role to ch
+func (e *OsMetrics) collect(ch chan<- prometheus.Metric, b Bean, role string) {
+	collectGauge(ch, e.MaxFileDescriptorCount, b, "MaxFileDescriptorCount", role)
+	collectGauge(ch, e.OpenFileDescriptorCount, b, "OpenFileDescriptorCount", role)
+	collectGauge(ch, e.CommittedVirtualMemorySize, b, "CommittedVirtualMemorySize", role)
+	collectGauge(ch, e.TotalSwapSpaceSize, b, "TotalSwapSpaceSize", role)
+	collectGauge(ch, e.FreeSwapSpaceSize, b, "FreeSwapSpaceSize", role)
+	collectGauge(ch, e.TotalPhysicalMemorySize, b, "TotalPhysicalMemorySize", role)
+	collectGauge(ch, e.SystemCpuLoad, b, "SystemCpuLoad", role)
+	collectGauge(ch, e.ProcessCpuLoad, b, "ProcessCpuLoad", role)
+	collectGauge(ch, e.FreePhysicalMemorySize, b, "FreePhysicalMemorySize", role)
+	collectGauge(ch, e.AvailableProcessors, b, "AvailableProcessors", role)
+	collectGauge(ch, e.SystemLoadAverage, b, "SystemLoadAverage", role)
+
+	// ProcessCpuTime is nanoseconds
+	if v, ok := b.float("ProcessCpuTime"); ok {
+		ch <- prometheus.MustNewConstMetric(e.ProcessCpuTime, e.counterValueType(), v/1e9, role)
+		if e.legacyGaugeNames {
+			ch <- prometheus.MustNewConstMetric(e.LegacyProcessCpuTime, prometheus.GaugeValue, v, role)
+		}
+	}
+
+	arch, ok1 := b.string("Arch")
+	name, ok2 := b.string("Name")
+	version, ok3 := b.string("Version")
+	if ok1 && ok2 && ok3 {
+		ch <- prometheus.MustNewConstMetric(e.OsUnameInfo, prometheus.GaugeValue, 1, role, arch, name, version)
+	}
 }
@@ -1,58 +1,47 @@
 package collector
 
 import (
-	"encoding/json"
 	"strings"
 
+	"hadoop_jmx_exporter/jmx"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/log"
 )
 
 // https://hadoop.apache.org/docs/stable/hadoop-project-dist/hadoop-common/Metrics.html#ClusterMetrics
 type ClusterMetrics struct {
-	NodeManagerNums        *prometheus.GaugeVec
-	AMLaunchDelayNumOps    prometheus.Gauge
-	AMLaunchDelayAvgTime   prometheus.Gauge
-	AMRegisterDelayNumOps  prometheus.Gauge
-	AMRegisterDelayAvgTime prometheus.Gauge
+	NodeManagerNums        *prometheus.Desc
+	AMLaunchDelayNumOps    *prometheus.Desc
+	AMLaunchDelayAvgTime   *prometheus.Desc
+	AMRegisterDelayNumOps  *prometheus.Desc
+	AMRegisterDelayAvgTime *prometheus.Desc
 }
 
 // https://hadoop.apache.org/docs/stable/hadoop-project-dist/hadoop-common/Metrics.html#QueueMetrics
 type QueueMetrics struct {
-	Running_0    *prometheus.GaugeVec
-	Running_60   *prometheus.GaugeVec
-	Running_300  *prometheus.GaugeVec
-	Running_1440 *prometheus.GaugeVec
-	// AMResourceLimitMB                              *prometheus.GaugeVec
-	// AMResourceLimitVCores                          *prometheus.GaugeVec
-	// UsedAMResourceMB                               *prometheus.GaugeVec
-	// UsedAMResourceVCores                           *prometheus.GaugeVec
-	// UsedCapacity                                   *prometheus.GaugeVec
-	// AbsoluteUsedCapacity                           *prometheus.GaugeVec
-	AppsCount                                      *prometheus.GaugeVec
-	AggregateNodeLocalContainersAllocated          *prometheus.GaugeVec
-	AggregateRackLocalContainersAllocated          *prometheus.GaugeVec
-	AggregateOffSwitchContainersAllocated          *prometheus.GaugeVec
-	AggregateContainersPreempted                   *prometheus.GaugeVec
-	AggregateMemoryMBSecondsPreempted              *prometheus.GaugeVec
-	AggregateVcoreSecondsPreempted                 *prometheus.GaugeVec
-	ActiveUsers                                    *prometheus.GaugeVec
-	ActiveApplications                             *prometheus.GaugeVec
-	AppAttemptFirstContainerAllocationDelayNumOps  *prometheus.GaugeVec
-	AppAttemptFirstContainerAllocationDelayAvgTime *prometheus.GaugeVec
-	AllocatedMB                                    *prometheus.GaugeVec
-	AllocatedVCores                                *prometheus.GaugeVec
-	AllocatedContainers                            *prometheus.GaugeVec
-	AggregateContainersAllocated                   *prometheus.GaugeVec
-	AggregateContainersReleased                    *prometheus.GaugeVec
-	AvailableMB                                    *prometheus.GaugeVec
-	AvailableVCores                                *prometheus.GaugeVec
-	PendingMB                                      *prometheus.GaugeVec
-	PendingVCores                                  *prometheus.GaugeVec
-	PendingContainers                              *prometheus.GaugeVec
-	ReservedMB                                     *prometheus.GaugeVec
-	ReservedVCores                                 *prometheus.GaugeVec
-	ReservedContainers                             *prometheus.GaugeVec
+	Running_0    *prometheus.Desc
+	Running_60   *prometheus.Desc
+	Running_300  *prometheus.Desc
+	Running_1440 *prometheus.Desc
+	// AMResourceLimitMB                              *prometheus.Desc
+	// AMResourceLimitVCores                          *prometheus.Desc
+	// UsedAMResourceMB                               *prometheus.Desc
+	// UsedAMResourceVCores                           *prometheus.Desc
+	// UsedCapacity                                   *prometheus.Desc
+	// AbsoluteUsedCapacity                           *prometheus.Desc
+	AppsCount                                      *prometheus.Desc
+	AppsCountTotal                                 *prometheus.Desc
+	AggregateContainers                            *prometheus.Desc // allocated, released and preempted
+	AggregateContainersAllocatedByLocality         *prometheus.Desc // node local, rack local and off switch
+	AggregateMemoryMBSecondsPreempted              *prometheus.Desc
+	AggregateVcoreSecondsPreempted                 *prometheus.Desc
+	ActiveUsers                                    *prometheus.Desc
+	ActiveApplications                             *prometheus.Desc
+	AppAttemptFirstContainerAllocationDelayNumOps  *prometheus.Desc
+	AppAttemptFirstContainerAllocationDelayAvgTime *prometheus.Desc
+	MemoryMB                                       *prometheus.Desc // allocated, available, pending and reserved
+	VCores                                         *prometheus.Desc // allocated, available, pending and reserved
+	Containers                                     *prometheus.Desc // allocated, pending and reserved
 }
 
 type ResourceManagerMetrics struct {
@@ -66,294 +55,141 @@ func NewResourceManagerMetrics(t Target) *ResourceManagerMetrics {
 	const namespace = "yarn_resourcemanager"
 
 	return &ResourceManagerMetrics{
-		BaseMetrics: BuildBaseMetrics(t.BodyData, namespace),
+		BaseMetrics: BuildBaseMetrics(t, namespace),
 		ClusterMetrics: ClusterMetrics{
-			NodeManagerNums: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "cluster_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"state"}),
-			AMLaunchDelayNumOps: prometheus.NewGauge(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "cluster_metrics",
-				Name:      "am_launch_delay_num_ops",
-				Help:      "Total number of AMs launched",
-			}),
-			AMLaunchDelayAvgTime: prometheus.NewGauge(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "cluster_metrics",
-				Name:      "am_launch_delay_avg_time_milliseconds",
-				Help:      "Average time in milliseconds RM spends to launch AM containers after the AM container is allocated",
-			}),
-			AMRegisterDelayNumOps: prometheus.NewGauge(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "cluster_metrics",
-				Name:      "am_register_delay_num_ops",
-				Help:      "Total number of AMs registered",
-			}),
-			AMRegisterDelayAvgTime: prometheus.NewGauge(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "cluster_metrics",
-				Name:      "am_register_delay_avg_time_milliseconds",
-				Help:      "Average time in milliseconds AM spends to register with RM after the AM container gets launched",
-			}),
+			NodeManagerNums:        newDesc(namespace, "cluster_metrics", "nodemanager_nums", "Current NodeManagers numbers of each state", "state"),
+			AMLaunchDelayNumOps:    newCounterDesc(t, namespace, "cluster_metrics", "am_launch_delay_num_ops", "Total number of AMs launched"),
+			AMLaunchDelayAvgTime:   newDesc(namespace, "cluster_metrics", "am_launch_delay_avg_time_milliseconds", "Average time in milliseconds RM spends to launch AM containers after the AM container is allocated"),
+			AMRegisterDelayNumOps:  newCounterDesc(t, namespace, "cluster_metrics", "am_register_delay_num_ops", "Total number of AMs registered"),
+			AMRegisterDelayAvgTime: newDesc(namespace, "cluster_metrics", "am_register_delay_avg_time_milliseconds", "Average time in milliseconds AM spends to register with RM after the AM container gets launched"),
 		},
 		QueueMetrics: QueueMetrics{
-			Running_0: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "running_0",
-				Help:      "Current number of running applications whose elapsed time are less than 60 minutes",
-			}, []string{"queue"}),
-			Running_60: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "running_60",
-				Help:      "Current number of running applications whose elapsed time are between 60 and 300 minutes",
-			}, []string{"queue"}),
-			Running_300: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "running_300",
-				Help:      "Current number of running applications whose elapsed time are between 300 and 1440 minutes",
-			}, []string{"queue"}),
-			Running_1440: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "Running_1440",
-				Help:      "Current number of running applications elapsed time are more than 1440 minutes",
-			}, []string{"queue"}),
-			// AMResourceLimitMB: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			// 	Namespace: namespace,
-			// 	Subsystem: "queue_metrics",
-			// 	Name:      "nodemanager_nums",
-			// 	Help:      "Current NodeManagers numbers of each state",
-			// }, []string{"queue"}),
-			// AMResourceLimitVCores: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			// 	Namespace: namespace,
-			// 	Subsystem: "queue_metrics",
-			// 	Name:      "nodemanager_nums",
-			// 	Help:      "Current NodeManagers numbers of each state",
-			// }, []string{"queue"}),
-			// UsedAMResourceMB: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			// 	Namespace: namespace,
-			// 	Subsystem: "queue_metrics",
-			// 	Name:      "nodemanager_nums",
-			// 	Help:      "Current NodeManagers numbers of each state",
-			// }, []string{"queue"}),
-			// UsedAMResourceVCores: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			// 	Namespace: namespace,
-			// 	Subsystem: "queue_metrics",
-			// 	Name:      "nodemanager_nums",
-			// 	Help:      "Current NodeManagers numbers of each state",
-			// }, []string{"queue"}),
-			// UsedCapacity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			// 	Namespace: namespace,
-			// 	Subsystem: "queue_metrics",
-			// 	Name:      "nodemanager_nums",
-			// 	Help:      "Current NodeManagers numbers of each state",
-			// }, []string{"queue"}),
-			// AbsoluteUsedCapacity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			// 	Namespace: namespace,
-			// 	Subsystem: "queue_metrics",
-			// 	Name:      "nodemanager_nums",
-			// 	Help:      "Current NodeManagers numbers of each state",
-			// }, []string{"queue"}),
-			AppsCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "apps_count",
-				Help:      "Applications count of each state",
-			}, []string{"queue", "state"}),
-			AggregateNodeLocalContainersAllocated: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AggregateRackLocalContainersAllocated: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AggregateOffSwitchContainersAllocated: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AggregateContainersPreempted: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AggregateMemoryMBSecondsPreempted: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AggregateVcoreSecondsPreempted: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			ActiveUsers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			ActiveApplications: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AppAttemptFirstContainerAllocationDelayNumOps: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AppAttemptFirstContainerAllocationDelayAvgTime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AllocatedMB: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AllocatedVCores: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AllocatedContainers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AggregateContainersAllocated: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AggregateContainersReleased: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AvailableMB: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			AvailableVCores: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			PendingMB: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			PendingVCores: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			PendingContainers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			ReservedMB: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			ReservedVCores: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
-			ReservedContainers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Subsystem: "queue_metrics",
-				Name:      "nodemanager_nums",
-				Help:      "Current NodeManagers numbers of each state",
-			}, []string{"queue"}),
+			Running_0:    newDesc(namespace, "queue_metrics", "running_0", "Current number of running applications whose elapsed time are less than 60 minutes", "queue"),
+			Running_60:   newDesc(namespace, "queue_metrics", "running_60", "Current number of running applications whose elapsed time are between 60 and 300 minutes", "queue"),
+			Running_300:  newDesc(namespace, "queue_metrics", "running_300", "Current number of running applications whose elapsed time are between 300 and 1440 minutes", "queue"),
+			Running_1440: newDesc(namespace, "queue_metrics", "running_1440", "Current number of running applications elapsed time are more than 1440 minutes", "queue"),
+			AppsCount:    newDesc(namespace, "queue_metrics", "apps_count", "Applications count of each state", "queue", "state"),
+			// the states that only grow, same help so they stay one gauge with --compat.legacy-gauge-names
+			AppsCountTotal:                                 newCounterDesc(t, namespace, "queue_metrics", "apps_count", "Applications count of each state", "queue", "state"),
+			AggregateContainers:                            newCounterDesc(t, namespace, "queue_metrics", "aggregate_containers", "Total number of containers of each state", "queue", "state"),
+			AggregateContainersAllocatedByLocality:         newCounterDesc(t, namespace, "queue_metrics", "aggregate_containers_allocated_by_locality", "Total number of allocated containers of each locality", "queue", "locality"),
+			AggregateMemoryMBSecondsPreempted:              newCounterDesc(t, namespace, "queue_metrics", "aggregate_memory_mb_seconds_preempted", "Total memory MB seconds of preempted containers", "queue"),
+			AggregateVcoreSecondsPreempted:                 newCounterDesc(t, namespace, "queue_metrics", "aggregate_vcore_seconds_preempted", "Total vcore seconds of preempted containers", "queue"),
+			ActiveUsers:                                    newDesc(namespace, "queue_metrics", "active_users", "Current number of active users", "queue"),
+			ActiveApplications:                             newDesc(namespace, "queue_metrics", "active_applications", "Current number of active applications", "queue"),
+			AppAttemptFirstContainerAllocationDelayNumOps:  newCounterDesc(t, namespace, "queue_metrics", "app_attempt_first_container_allocation_delay_num_ops", "Total number of first containers allocated for app attempts", "queue"),
+			AppAttemptFirstContainerAllocationDelayAvgTime: newDesc(namespace, "queue_metrics", "app_attempt_first_container_allocation_delay_avg_time_milliseconds", "Average time in milliseconds to allocate the first container of an app attempt", "queue"),
+			MemoryMB:   newDesc(namespace, "queue_metrics", "memory_mb", "Current memory in MB of each state", "queue", "state"),
+			VCores:     newDesc(namespace, "queue_metrics", "vcores", "Current vcores of each state", "queue", "state"),
+			Containers: newDesc(namespace, "queue_metrics", "containers", "Current number of containers of each state", "queue", "state"),
 		},
 	}
 }
 
+func (e *ResourceManagerMetrics) Describe(ch chan<- *prometheus.Desc) {
+	e.BaseMetrics.Describe(ch)
+	ch <- e.NodeManagerNums
+	ch <- e.AMLaunchDelayNumOps
+	ch <- e.AMLaunchDelayAvgTime
+	ch <- e.AMRegisterDelayNumOps
+	ch <- e.AMRegisterDelayAvgTime
+	ch <- e.Running_0
+	ch <- e.Running_60
+	ch <- e.Running_300
+	ch <- e.Running_1440
+	ch <- e.AppsCount
+	ch <- e.AppsCountTotal
+	ch <- e.AggregateContainers
+	ch <- e.AggregateContainersAllocatedByLocality
+	ch <- e.AggregateMemoryMBSecondsPreempted
+	ch <- e.AggregateVcoreSecondsPreempted
+	ch <- e.ActiveUsers
+	ch <- e.ActiveApplications
+	ch <- e.AppAttemptFirstContainerAllocationDelayNumOps
+	ch <- e.AppAttemptFirstContainerAllocationDelayAvgTime
+	ch <- e.MemoryMB
+	ch <- e.VCores
+	ch <- e.Containers
+}
+
 // Collect implements the prometheus.Collector interface.
 func (e *ResourceManagerMetrics) Collect(ch chan<- prometheus.Metric) {
-	var err error
-
-	var f interface{}
-	err = json.Unmarshal(e.BodyData, &f)
-	if err != nil {
-		log.Error(err)
+	e.collectGc(ch, "Hadoop:service=ResourceManager,name=JvmMetrics")
+
+	if bean, ok := e.Beans.Get("Hadoop:service=ResourceManager,name=ClusterMetrics"); ok {
+		collectGauge(ch, e.NodeManagerNums, bean, "NumActiveNMs", "active")
+		collectGauge(ch, e.NodeManagerNums, bean, "NumDecommissioningNMs", "decommissioning")
+		collectGauge(ch, e.NodeManagerNums, bean, "NumDecommissionedNMs", "decommissioned")
+		collectGauge(ch, e.NodeManagerNums, bean, "NumLostNMs", "lost")
+		collectGauge(ch, e.NodeManagerNums, bean, "NumUnhealthyNMs", "unhealthy")
+		collectGauge(ch, e.NodeManagerNums, bean, "NumRebootedNMs", "rebooted")
+		collectGauge(ch, e.NodeManagerNums, bean, "NumShutdownNMs", "shutdown")
+
+		e.collectCounter(ch, e.AMLaunchDelayNumOps, bean, "AMLaunchDelayNumOps")
+		collectGauge(ch, e.AMLaunchDelayAvgTime, bean, "AMLaunchDelayAvgTime")
+		e.collectCounter(ch, e.AMRegisterDelayNumOps, bean, "AMRegisterDelayNumOps")
+		collectGauge(ch, e.AMRegisterDelayAvgTime, bean, "AMRegisterDelayAvgTime")
 	}
-	m := f.(map[string]interface{})
-	var List = m["beans"].([]interface{})
-	for _, Data := range List {
-		DataMap := Data.(map[string]interface{})
-
-		if DataMap["name"] == "Hadoop:service=ResourceManager,name=ClusterMetrics" {
-			e.NodeManagerNums.WithLabelValues("active").Set(DataMap["NumActiveNMs"].(float64))
-			e.NodeManagerNums.WithLabelValues("decommissioning").Set(DataMap["NumActiveNMs"].(float64))
-			e.NodeManagerNums.WithLabelValues("decommissioned").Set(DataMap["NumDecommissionedNMs"].(float64))
-			e.NodeManagerNums.WithLabelValues("lost").Set(DataMap["NumLostNMs"].(float64))
-			e.NodeManagerNums.WithLabelValues("unhealthy").Set(DataMap["NumUnhealthyNMs"].(float64))
-			e.NodeManagerNums.WithLabelValues("rebooted").Set(DataMap["NumRebootedNMs"].(float64))
-			e.NodeManagerNums.WithLabelValues("shutdown").Set(DataMap["NumShutdownNMs"].(float64))
 
+	pattern, _ := jmx.ParseObjectNamePattern("Hadoop:service=ResourceManager,name=QueueMetrics,*")
+	for _, bean := range e.Beans.Match(pattern) {
+		// Hadoop:service=ResourceManager,name=QueueMetrics,q0=root,user=hive has the tag.Queue of its
+		// queue, it would export the series of the queue a second time
+		o, _ := bean.ObjectName()
+		if _, ok := o.Props["user"]; ok {
+			continue
 		}
 
-		if strings.HasPrefix(DataMap["name"].(string), "Hadoop:service=ResourceManager,name=QueueMetrics") {
-			queue := DataMap["tag.Queue"].(string)
-			e.AppsCount.WithLabelValues(queue, "submitted").Set(DataMap["AppsSubmitted"].(float64))
-			e.AppsCount.WithLabelValues(queue, "running").Set(DataMap["AppsRunning"].(float64))
-			e.AppsCount.WithLabelValues(queue, "pending").Set(DataMap["AppsPending"].(float64))
-			e.AppsCount.WithLabelValues(queue, "completed").Set(DataMap["AppsCompleted"].(float64))
-			e.AppsCount.WithLabelValues(queue, "killed").Set(DataMap["AppsKilled"].(float64))
-			e.AppsCount.WithLabelValues(queue, "failed").Set(DataMap["AppsFailed"].(float64))
-
+		queue, ok := bean.string("tag.Queue")
+		if !ok {
+			continue
 		}
 
+		collectGauge(ch, e.Running_0, bean, "running_0", queue)
+		collectGauge(ch, e.Running_60, bean, "running_60", queue)
+		collectGauge(ch, e.Running_300, bean, "running_300", queue)
+		collectGauge(ch, e.Running_1440, bean, "running_1440", queue)
+
+		e.collectCounter(ch, e.AppsCountTotal, bean, "AppsSubmitted", queue, "submitted")
+		collectGauge(ch, e.AppsCount, bean, "AppsRunning", queue, "running")
+		collectGauge(ch, e.AppsCount, bean, "AppsPending", queue, "pending")
+		e.collectCounter(ch, e.AppsCountTotal, bean, "AppsCompleted", queue, "completed")
+		e.collectCounter(ch, e.AppsCountTotal, bean, "AppsKilled", queue, "killed")
+		e.collectCounter(ch, e.AppsCountTotal, bean, "AppsFailed", queue, "failed")
+
+		e.collectCounter(ch, e.AggregateContainers, bean, "AggregateContainersAllocated", queue, "allocated")
+		e.collectCounter(ch, e.AggregateContainers, bean, "AggregateContainersReleased", queue, "released")
+		e.collectCounter(ch, e.AggregateContainers, bean, "AggregateContainersPreempted", queue, "preempted")
+		e.collectCounter(ch, e.AggregateContainersAllocatedByLocality, bean, "AggregateNodeLocalContainersAllocated", queue, "node_local")
+		e.collectCounter(ch, e.AggregateContainersAllocatedByLocality, bean, "AggregateRackLocalContainersAllocated", queue, "rack_local")
+		e.collectCounter(ch, e.AggregateContainersAllocatedByLocality, bean, "AggregateOffSwitchContainersAllocated", queue, "off_switch")
+		e.collectCounter(ch, e.AggregateMemoryMBSecondsPreempted, bean, "AggregateMemoryMBSecondsPreempted", queue)
+		e.collectCounter(ch, e.AggregateVcoreSecondsPreempted, bean, "AggregateVcoreSecondsPreempted", queue)
+
+		collectGauge(ch, e.ActiveUsers, bean, "ActiveUsers", queue)
+		collectGauge(ch, e.ActiveApplications, bean, "ActiveApplications", queue)
+		e.collectCounter(ch, e.AppAttemptFirstContainerAllocationDelayNumOps, bean, "AppAttemptFirstContainerAllocationDelayNumOps", queue)
+		collectGauge(ch, e.AppAttemptFirstContainerAllocationDelayAvgTime, bean, "AppAttemptFirstContainerAllocationDelayAvgTime", queue)
+
+		for _, state := range []string{"Allocated", "Available", "Pending", "Reserved"} {
+			collectGauge(ch, e.MemoryMB, bean, state+"MB", queue, strings.ToLower(state))
+			collectGauge(ch, e.VCores, bean, state+"VCores", queue, strings.ToLower(state))
+		}
+		for _, state := range []string{"Allocated", "Pending", "Reserved"} {
+			collectGauge(ch, e.Containers, bean, state+"Containers", queue, strings.ToLower(state))
+		}
 	}
+}
 
-	e.NodeManagerNums.Collect(ch)
-	e.AppsCount.Collect(ch)
+// beans read by ResourceManagerCollector, see Target.fetchBeans
+var resourceManagerQueries = []string{
+	"Hadoop:service=ResourceManager,name=ClusterMetrics",
+	"Hadoop:service=ResourceManager,name=QueueMetrics,*",
+	"Hadoop:service=ResourceManager,name=JvmMetrics",
 }
 
 func ResourceManagerCollector(target Target, registry *prometheus.Registry) (success bool) {
 
 	metrics := NewResourceManagerMetrics(target)
-	registry.MustRegister(metrics)
-
-	return true
+	return register(target, registry, metrics)
 }
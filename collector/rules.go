@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hadoop_jmx_exporter/config"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RulesMetrics exports the attributes matched by the rules of the configuration, it is registered
+// after the collectors of the detected services
+type RulesMetrics struct {
+	Beans  *BeanIndex
+	Rules  []config.Rule
+	Logger log.Logger
+}
+
+// ruleValueType returns the value type of the metrics of rule, gauge by default
+func ruleValueType(rule config.Rule) prometheus.ValueType {
+	switch rule.Type {
+	case "counter":
+		return prometheus.CounterValue
+	case "untyped":
+		return prometheus.UntypedValue
+	}
+	return prometheus.GaugeValue
+}
+
+func (e *RulesMetrics) Describe(ch chan<- *prometheus.Desc) {
+
+}
+
+// Collect implements the prometheus.Collector interface, the first rule matching an attribute wins
+func (e *RulesMetrics) Collect(ch chan<- prometheus.Metric) {
+	unique := newUniqueMetrics()
+
+	for _, bean := range e.Beans.Beans() {
+		o, ok := bean.ObjectName()
+		if !ok {
+			continue
+		}
+
+		var matching []config.Rule
+		for _, rule := range e.Rules {
+			if o.Match(rule.ObjectNamePattern()) {
+				matching = append(matching, rule)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+
+		for _, attr := range bean.Numbers() {
+			for _, rule := range matching {
+				submatches := rule.AttributeRegexp().FindStringSubmatch(attr.Name)
+				if submatches == nil {
+					continue
+				}
+
+				expand := func(template string) string {
+					return os.Expand(template, func(key string) string {
+						if key == "attribute" {
+							return attr.Name
+						}
+						if i, err := strconv.Atoi(key); err == nil {
+							if i < len(submatches) {
+								return submatches[i]
+							}
+							return ""
+						}
+						return strings.Trim(o.Props[key], `"`)
+					})
+				}
+
+				name := sanitizeMetricName(expand(rule.Name))
+
+				labelNames := make([]string, 0, len(rule.Labels))
+				for label := range rule.Labels {
+					labelNames = append(labelNames, label)
+				}
+				sort.Strings(labelNames)
+				labelValues := make([]string, len(labelNames))
+				for i, label := range labelNames {
+					labelValues[i] = expand(rule.Labels[label])
+				}
+
+				help := rule.Help
+				if help == "" {
+					help = "Attribute of " + rule.Pattern
+				}
+				factor := rule.ValueFactor
+				if factor == 0 {
+					factor = 1
+				}
+				err := unique.send(ch, name, help, ruleValueType(rule), attr.Value*factor, labelNames, labelValues)
+				if err != nil {
+					level.Error(e.Logger).Log("msg", "Error create metric of rule", "pattern", rule.Pattern, "bean", bean.Name(), "attribute", attr.Name, "err", err)
+				}
+				break
+			}
+		}
+	}
+}
+
+// uniqueMetrics sends const metrics and drops the series that were sent before, the same series
+// from two beans or rules would fail the whole scrape
+type uniqueMetrics struct {
+	seen  map[string]bool
+	helps map[string]string
+}
+
+func newUniqueMetrics() *uniqueMetrics {
+	return &uniqueMetrics{seen: map[string]bool{}, helps: map[string]string{}}
+}
+
+// send sends the series unless it was sent before, the help of the first series of a metric is kept
+func (u *uniqueMetrics) send(ch chan<- prometheus.Metric, name string, help string, valueType prometheus.ValueType, value float64, labelNames []string, labelValues []string) error {
+	key := name + "\xff" + strings.Join(labelNames, "\xff") + "\xff" + strings.Join(labelValues, "\xff")
+	if u.seen[key] {
+		return nil
+	}
+	u.seen[key] = true
+
+	if h, ok := u.helps[name]; ok {
+		help = h
+	}
+	u.helps[name] = help
+
+	metric, err := prometheus.NewConstMetric(prometheus.NewDesc(name, help, labelNames, nil), valueType, value, labelValues...)
+	if err != nil {
+		return err
+	}
+	ch <- metric
+	return nil
+}
+
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// sanitizeMetricName replaces the characters not allowed in metric names with _
+func sanitizeMetricName(name string) string {
+	name = invalidMetricChars.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// rulePatterns returns the ObjectName patterns of rules, fetched with /jmx?qry= like the ones of the collectors
+func rulePatterns(rules []config.Rule) []string {
+	patterns := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if !containsString(patterns, rule.Pattern) {
+			patterns = append(patterns, rule.Pattern)
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"hadoop_jmx_exporter/config"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const rulesBeans = `{"beans": [
+	{"name": "Hadoop:service=Router,name=FederationRPC", "ProxyOp": 12, "ProxyOpFailureCommunicate": 2, "tag.Hostname": "router1"},
+	{"name": "java.lang:type=MemoryPool,name=Metaspace", "Usage": {"used": 100, "max": 200, "committed": 150}},
+	{"name": "Hadoop:service=NameNode,name=JvmMetrics", "GcTimeMillis": 1500, "GcCount": 3}
+]}`
+
+func TestRulesMetrics(t *testing.T) {
+	beans, err := decodeBeans([]byte(rulesBeans))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		rules    []config.Rule
+		expected string
+	}{
+		{
+			name: "empty attribute matches every numeric attribute",
+			rules: []config.Rule{
+				{Pattern: "Hadoop:service=Router,name=FederationRPC", Name: "router_$attribute", Help: "router"},
+			},
+			expected: `
+# HELP router_ProxyOp router
+# TYPE router_ProxyOp gauge
+router_ProxyOp 12
+# HELP router_ProxyOpFailureCommunicate router
+# TYPE router_ProxyOpFailureCommunicate gauge
+router_ProxyOpFailureCommunicate 2
+`,
+		},
+		{
+			name: "submatches and key properties are expanded",
+			rules: []config.Rule{
+				{Pattern: "java.lang:type=MemoryPool,*", Attribute: `Usage\.(used|max)`, Name: "jvm_memory_pool_$1_bytes", Help: "pool", Labels: map[string]string{"pool": "${name}"}},
+			},
+			expected: `
+# HELP jvm_memory_pool_max_bytes pool
+# TYPE jvm_memory_pool_max_bytes gauge
+jvm_memory_pool_max_bytes{pool="Metaspace"} 200
+# HELP jvm_memory_pool_used_bytes pool
+# TYPE jvm_memory_pool_used_bytes gauge
+jvm_memory_pool_used_bytes{pool="Metaspace"} 100
+`,
+		},
+		{
+			name: "first matching rule wins",
+			rules: []config.Rule{
+				{Pattern: "Hadoop:service=Router,*", Attribute: "ProxyOp", Name: "router_proxy_op", Help: "first"},
+				{Pattern: "Hadoop:service=Router,*", Attribute: "ProxyOp.*", Name: "router_$attribute", Help: "second"},
+			},
+			expected: `
+# HELP router_ProxyOpFailureCommunicate second
+# TYPE router_ProxyOpFailureCommunicate gauge
+router_ProxyOpFailureCommunicate 2
+# HELP router_proxy_op first
+# TYPE router_proxy_op gauge
+router_proxy_op 12
+`,
+		},
+		{
+			name: "value factor and counter type",
+			rules: []config.Rule{
+				{Pattern: "Hadoop:service=*,name=JvmMetrics", Attribute: "GcTimeMillis", Name: "gc_seconds_total", Help: "gc", Type: "counter", ValueFactor: 0.001},
+			},
+			expected: `
+# HELP gc_seconds_total gc
+# TYPE gc_seconds_total counter
+gc_seconds_total 1.5
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := range test.rules {
+				if err := test.rules[i].Validate(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			metrics := &RulesMetrics{Beans: beans, Rules: test.rules, Logger: log.NewNopLogger()}
+			if err := testutil.CollectAndCompare(metrics, strings.NewReader(test.expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// stages of a scrape, the stage label of hadoop_jmx_export_error_info
+const (
+	StageFetch  = "fetch"
+	StageAuth   = "auth"
+	StageDetect = "detect"
+	StageParse  = "parse"
+)
+
+// scrapeError is an error of one stage of the scrape, exported as hadoop_jmx_export_error_info{stage,reason}
+// so a down service, an expired keytab and a broken collector can be told apart
+type scrapeError struct {
+	stage  string
+	reason string
+	err    error
+}
+
+func (e *scrapeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *scrapeError) Unwrap() error {
+	return e.err
+}
+
+// errorStage returns the stage and reason of err, errors of no stage count as fetch errors
+func errorStage(err error) (string, string) {
+	var e *scrapeError
+	if errors.As(err, &e) {
+		return e.stage, e.reason
+	}
+	return StageFetch, "error"
+}
+
+// statusRecorder records the status code of every response of the target, the last one is exported
+// as hadoop_jmx_fetch_status_code
+type statusRecorder struct {
+	rt   http.RoundTripper
+	code *atomic.Int32
+}
+
+func (s statusRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := s.rt.RoundTrip(req)
+	if err == nil {
+		s.code.Store(int32(resp.StatusCode))
+	}
+	return resp, err
+}
+
+// gatherCollector runs the collector name with a registry of its own and gathers it right away, so
+// the success of each collector is known before the response is written. The collector fails when it
+// exports nothing or finds an attribute with an unexpected type, its metrics are still returned
+func gatherCollector(t Target, name string) (prometheus.Gatherer, error) {
+	registry := prometheus.NewRegistry()
+	if !collectorFor(name)(t, registry) {
+		return nil, &scrapeError{stage: StageParse, reason: "register", err: fmt.Errorf("collector %s could not be registered", name)}
+	}
+	jvmRegistry := prometheus.NewRegistry()
+	if !t.SkipJvmMetrics && !register(t, jvmRegistry, NewJvmMetrics(t, name)) {
+		return nil, &scrapeError{stage: StageParse, reason: "register", err: fmt.Errorf("jvm metrics of %s could not be registered", name)}
+	}
+
+	before := t.Beans.TypeErrors()
+	collector, err := gathered(registry)
+	jvm, jvmErr := gathered(jvmRegistry)
+	typeErrors := t.Beans.TypeErrors() - before
+	g := prometheus.Gatherers{collector, jvm}
+	if err != nil {
+		return g, err
+	}
+	if jvmErr != nil {
+		return g, jvmErr
+	}
+	if typeErrors > 0 {
+		return g, &scrapeError{stage: StageParse, reason: "attribute", err: fmt.Errorf("%d attributes of collector %s have an unexpected type", typeErrors, name)}
+	}
+	// a service after the first one in the process, like the region server of a local mode master,
+	// may only have jvm beans which are read by the first one
+	if families, _ := collector.Gather(); len(families) == 0 && !t.SkipJvmMetrics {
+		return g, &scrapeError{stage: StageParse, reason: "missing_beans", err: fmt.Errorf("no bean of collector %s found", name)}
+	}
+	return g, nil
+}
+
+// gathered gathers g once, the result can be gathered again together with other gatherers
+func gathered(g prometheus.Gatherer) (prometheus.Gatherer, error) {
+	families, err := g.Gather()
+	if err != nil {
+		err = &scrapeError{stage: StageParse, reason: "collect", err: err}
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	}), err
+}
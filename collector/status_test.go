@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestGatherCollector(t *testing.T) {
+	tests := []struct {
+		name       string
+		beans      string
+		skipJvm    bool
+		wantReason string
+	}{
+		{
+			name:  "all attributes",
+			beans: `{"name":"Hadoop:service=DataNode,name=FSDatasetState","Capacity":100,"DfsUsed":10,"Remaining":90}`,
+		},
+		{
+			// CacheCapacity and friends are missing, e.g. in an older version
+			name:  "missing attributes",
+			beans: `{"name":"Hadoop:service=DataNode,name=FSDatasetState","Capacity":100}`,
+		},
+		{
+			name:       "attribute of another type",
+			beans:      `{"name":"Hadoop:service=DataNode,name=FSDatasetState","Capacity":100,"DfsUsed":"oops"}`,
+			wantReason: "attribute",
+		},
+		{
+			name:       "no bean",
+			beans:      `{"name":"Hadoop:service=NameNode,name=FSNamesystem","MissingBlocks":0}`,
+			wantReason: "missing_beans",
+		},
+		{
+			name:    "no bean after the first service of the process",
+			beans:   `{"name":"Hadoop:service=NameNode,name=FSNamesystem","MissingBlocks":0}`,
+			skipJvm: true,
+		},
+	}
+	for _, tt := range tests {
+		beans, err := decodeBeans([]byte(`{"beans":[` + tt.beans + `]}`))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		target := Target{Beans: beans, SkipJvmMetrics: tt.skipJvm, Logger: log.NewNopLogger()}
+
+		g, err := gatherCollector(target, "DataNode")
+		if g == nil {
+			t.Fatalf("%s: no metrics returned", tt.name)
+		}
+		var e *scrapeError
+		switch {
+		case tt.wantReason == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.wantReason != "" && !errors.As(err, &e):
+			t.Errorf("%s: error %v, want reason %s", tt.name, err, tt.wantReason)
+		case tt.wantReason != "" && (e.stage != StageParse || e.reason != tt.wantReason):
+			t.Errorf("%s: stage %s reason %s, want %s %s", tt.name, e.stage, e.reason, StageParse, tt.wantReason)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"hadoop_jmx_exporter/jmx"
+
+	promconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the content of the file passed with --config.file
+type Config struct {
+	Secrets map[string]Secret `yaml:"secrets"`
+	Modules map[string]Module `yaml:"modules"`
+	// rules applied to every target, after the rules of the module
+	Rules []Rule `yaml:"rules"`
+}
+
+// Secret is a named password kept outside the config, read from a file or an environment variable
+type Secret struct {
+	File string `yaml:"file"`
+	Env  string `yaml:"env"`
+}
+
+// Module groups the settings used to scrape one kind of target, it is selected with ?module=<name>
+type Module struct {
+	Auth      Auth          `yaml:"auth"`
+	Kerberos  Kerberos      `yaml:"kerberos"`
+	Timeout   time.Duration `yaml:"timeout"`
+	Collector string        `yaml:"collector"`
+	// CA bundle, client certificate and server name used when the target is https
+	TLSConfig promconfig.TLSConfig `yaml:"tls_config"`
+	Rules     []Rule               `yaml:"rules"`
+}
+
+// Rule maps the attributes of the beans matching Pattern to a metric, in the spirit of the Java jmx_exporter
+type Rule struct {
+	// ObjectName pattern like the qry parameter of /jmx, e.g. Hadoop:service=Router,name=* or java.lang:type=MemoryPool,*
+	Pattern string `yaml:"pattern"`
+	// regular expression matching the whole attribute name, every numeric attribute when empty,
+	// attributes of composite values are named like HeapMemoryUsage.used
+	Attribute string `yaml:"attribute"`
+	// metric name, $attribute, the key properties of the bean like ${name} and the submatches
+	// of Attribute like $1 are replaced, characters not allowed in metric names become _
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	// label values are expanded like Name
+	Labels map[string]string `yaml:"labels"`
+	// gauge, counter or untyped, gauge by default
+	Type string `yaml:"type"`
+	// the value is multiplied by ValueFactor, e.g. 0.001 for milliseconds to seconds, 1 by default
+	ValueFactor float64 `yaml:"value_factor"`
+
+	// Pattern and Attribute compiled by Validate
+	pattern   jmx.ObjectName
+	attribute *regexp.Regexp
+}
+
+type Auth struct {
+	// none, simple, kerberos or basic, defaults to kerberos when a method is set and to none otherwise
+	Mode string `yaml:"mode"`
+	// user of simple (user.name) and basic auth
+	User string `yaml:"user"`
+	// kerberos method: password, keytab or ccache
+	Method    string `yaml:"method"`
+	Principal string `yaml:"principal"`
+	// password of kerberos password and basic auth, only one of Password, PasswordFile, PasswordEnv and PasswordSecret may be set
+	Password       string `yaml:"password"`
+	PasswordFile   string `yaml:"password_file"`
+	PasswordEnv    string `yaml:"password_env"`
+	PasswordSecret string `yaml:"password_secret"`
+	KeytabPath     string `yaml:"keytab_path"`
+	// credential cache kept fresh by kinit or k5start, the principal is read from it
+	CCachePath string `yaml:"ccache_path"`
+}
+
+// Kerberos selects the krb5 configuration of a module, by default the file given with --kerberos.config is used
+type Kerberos struct {
+	ConfigFile string `yaml:"config_file"`
+	// inline definition of the realm, used instead of a krb5.conf
+	Realm       string            `yaml:"realm"`
+	KDCs        []string          `yaml:"kdcs"`
+	DomainRealm map[string]string `yaml:"domain_realm"`
+}
+
+func LoadFile(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %v", err)
+	}
+
+	// relative certificate paths are relative to the config file
+	for name, module := range cfg.Modules {
+		module.TLSConfig.SetDirectory(filepath.Dir(path))
+		cfg.Modules[name] = module
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) Validate() error {
+	for i := range c.Rules {
+		if err := c.Rules[i].Validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	for name, secret := range c.Secrets {
+		if err := secret.Validate(); err != nil {
+			return fmt.Errorf("secret %q: %v", name, err)
+		}
+	}
+	for name, module := range c.Modules {
+		if err := module.Auth.Validate(); err != nil {
+			return fmt.Errorf("module %q: %v", name, err)
+		}
+		if ref := module.Auth.PasswordSecret; ref != "" {
+			if _, ok := c.Secrets[ref]; !ok {
+				return fmt.Errorf("module %q: unknown secret %q", name, ref)
+			}
+		}
+		if err := module.Kerberos.Validate(); err != nil {
+			return fmt.Errorf("module %q: %v", name, err)
+		}
+		if _, err := promconfig.NewTLSConfig(&module.TLSConfig); err != nil {
+			return fmt.Errorf("module %q: invalid tls_config: %v", name, err)
+		}
+		if module.Timeout < 0 {
+			return fmt.Errorf("module %q: timeout must not be negative", name)
+		}
+		for i := range module.Rules {
+			if err := module.Rules[i].Validate(); err != nil {
+				return fmt.Errorf("module %q: rule %d: %v", name, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks the rule and compiles Pattern and Attribute, so the rules are compiled once when the
+// config is loaded
+func (r *Rule) Validate() error {
+	pattern, err := jmx.ParseObjectNamePattern(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("pattern %q is not an ObjectName pattern like domain:key=value,*: %v", r.Pattern, err)
+	}
+	// the attribute must match as a whole, like the patterns of the Java jmx_exporter, an empty one
+	// matches every attribute
+	expr := ".*"
+	if r.Attribute != "" {
+		expr = "^(?:" + r.Attribute + ")$"
+	}
+	attribute, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid attribute regexp: %v", err)
+	}
+	if r.Name == "" {
+		return fmt.Errorf("rule requires a name")
+	}
+	for label := range r.Labels {
+		if !model.LabelName(label).IsValid() {
+			return fmt.Errorf("invalid label name %q", label)
+		}
+	}
+	switch r.Type {
+	case "", "gauge", "counter", "untyped":
+	default:
+		return fmt.Errorf("unsupported type %q", r.Type)
+	}
+	r.pattern = pattern
+	r.attribute = attribute
+	return nil
+}
+
+// ObjectNamePattern returns the parsed Pattern, set by Validate
+func (r *Rule) ObjectNamePattern() jmx.ObjectName {
+	return r.pattern
+}
+
+// AttributeRegexp returns Attribute anchored to match whole attribute names, set by Validate
+func (r *Rule) AttributeRegexp() *regexp.Regexp {
+	return r.attribute
+}
+
+// AuthMode returns the auth mode with the default applied
+func (a *Auth) AuthMode() string {
+	if a.Mode != "" {
+		return a.Mode
+	}
+	if a.Method != "" {
+		return "kerberos"
+	}
+	return "none"
+}
+
+func (a *Auth) Validate() error {
+	switch a.AuthMode() {
+	case "none":
+		return nil
+	case "simple":
+		if a.User == "" {
+			return fmt.Errorf("auth mode simple requires a user")
+		}
+		return nil
+	case "basic":
+		if a.User == "" {
+			return fmt.Errorf("auth mode basic requires a user")
+		}
+		return a.validatePassword()
+	case "kerberos":
+		return a.validateKerberos()
+	default:
+		return fmt.Errorf("unsupported auth mode %q", a.Mode)
+	}
+}
+
+func (a *Auth) validatePassword() error {
+	sources := 0
+	for _, v := range []string{a.Password, a.PasswordFile, a.PasswordEnv, a.PasswordSecret} {
+		if v != "" {
+			sources++
+		}
+	}
+	if sources == 0 {
+		return fmt.Errorf("auth mode %s requires one of password, password_file, password_env or password_secret", a.AuthMode())
+	}
+	if sources > 1 {
+		return fmt.Errorf("only one of password, password_file, password_env and password_secret may be set")
+	}
+	return nil
+}
+
+func (a *Auth) validateKerberos() error {
+	switch a.Method {
+	case "password":
+		if err := a.validatePassword(); err != nil {
+			return err
+		}
+	case "keytab":
+		if a.KeytabPath == "" {
+			return fmt.Errorf("auth method keytab requires a keytab_path")
+		}
+	case "ccache":
+		if a.CCachePath == "" {
+			return fmt.Errorf("auth method ccache requires a ccache_path")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported auth method %q", a.Method)
+	}
+
+	if a.Principal == "" {
+		return fmt.Errorf("auth method %s requires a principal", a.Method)
+	}
+	return nil
+}
+
+// Module returns the module with the given name, ok is false if it is not configured
+func (c *Config) Module(name string) (Module, bool) {
+	if c == nil {
+		return Module{}, false
+	}
+	module, ok := c.Modules[name]
+	return module, ok
+}
+
+func (k *Kerberos) Validate() error {
+	if k.ConfigFile != "" && k.Realm != "" {
+		return fmt.Errorf("kerberos config_file and realm are mutually exclusive")
+	}
+	if k.Realm == "" && (len(k.KDCs) > 0 || len(k.DomainRealm) > 0) {
+		return fmt.Errorf("kerberos kdcs and domain_realm require a realm")
+	}
+	return nil
+}
+
+func (s *Secret) Validate() error {
+	if (s.File == "") == (s.Env == "") {
+		return fmt.Errorf("exactly one of file or env must be set")
+	}
+	return nil
+}
+
+// Resolve reads the secret, it is called on every scrape so a rotated password file is picked up
+func (s *Secret) Resolve() (string, error) {
+	if s.File != "" {
+		content, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("error reading secret file: %v", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	value, ok := os.LookupEnv(s.Env)
+	if !ok || value == "" {
+		return "", fmt.Errorf("environment variable %s is not set", s.Env)
+	}
+	return value, nil
+}
+
+// SecretByName resolves a secret from the secrets section
+func (c *Config) SecretByName(name string) (string, error) {
+	if c == nil {
+		return "", fmt.Errorf("unknown secret %q", name)
+	}
+	secret, ok := c.Secrets[name]
+	if !ok {
+		return "", fmt.Errorf("unknown secret %q", name)
+	}
+	return secret.Resolve()
+}
+
+// ResolvePassword returns the password of the auth section, whichever way it is configured
+func (c *Config) ResolvePassword(a Auth) (string, error) {
+	switch {
+	case a.PasswordFile != "":
+		secret := Secret{File: a.PasswordFile}
+		return secret.Resolve()
+	case a.PasswordEnv != "":
+		secret := Secret{Env: a.PasswordEnv}
+		return secret.Resolve()
+	case a.PasswordSecret != "":
+		return c.SecretByName(a.PasswordSecret)
+	}
+	return a.Password, nil
+}
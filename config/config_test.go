@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	secrets := map[string]Secret{"cluster1": {Env: "CLUSTER1_PASSWORD"}}
+	kerberos := func(auth Auth) Auth {
+		auth.Method = "password"
+		auth.Principal = "hdfs@EXAMPLE.COM"
+		return auth
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{
+			name:   "password secret",
+			config: Config{Secrets: secrets, Modules: map[string]Module{"m": {Auth: kerberos(Auth{PasswordSecret: "cluster1"})}}},
+		},
+		{
+			name:    "password and password file",
+			config:  Config{Modules: map[string]Module{"m": {Auth: kerberos(Auth{Password: "x", PasswordFile: "/etc/password"})}}},
+			wantErr: "only one of",
+		},
+		{
+			name:    "password env and password secret",
+			config:  Config{Secrets: secrets, Modules: map[string]Module{"m": {Auth: kerberos(Auth{PasswordEnv: "PASSWORD", PasswordSecret: "cluster1"})}}},
+			wantErr: "only one of",
+		},
+		{
+			name:    "no password",
+			config:  Config{Modules: map[string]Module{"m": {Auth: kerberos(Auth{})}}},
+			wantErr: "requires one of",
+		},
+		{
+			name:    "basic auth without password",
+			config:  Config{Modules: map[string]Module{"m": {Auth: Auth{Mode: "basic", User: "admin"}}}},
+			wantErr: "requires one of",
+		},
+		{
+			name:    "unknown secret",
+			config:  Config{Secrets: secrets, Modules: map[string]Module{"m": {Auth: kerberos(Auth{PasswordSecret: "cluster2"})}}},
+			wantErr: `unknown secret "cluster2"`,
+		},
+		{
+			name:    "secret with file and env",
+			config:  Config{Secrets: map[string]Secret{"cluster1": {File: "/etc/password", Env: "PASSWORD"}}},
+			wantErr: "exactly one of",
+		},
+		{
+			name:    "secret without source",
+			config:  Config{Secrets: map[string]Secret{"cluster1": {}}},
+			wantErr: "exactly one of",
+		},
+	}
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.wantErr != "" && err == nil:
+			t.Errorf("%s: no error, want one containing %q", tt.name, tt.wantErr)
+		case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+			t.Errorf("%s: error %q does not contain %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSecretResolve(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JMX_EXPORTER_TEST_PASSWORD", "from env")
+	t.Setenv("JMX_EXPORTER_TEST_EMPTY", "")
+
+	tests := []struct {
+		secret  Secret
+		want    string
+		wantErr bool
+	}{
+		{secret: Secret{File: file}, want: "from file"},
+		{secret: Secret{File: file + ".missing"}, wantErr: true},
+		{secret: Secret{Env: "JMX_EXPORTER_TEST_PASSWORD"}, want: "from env"},
+		{secret: Secret{Env: "JMX_EXPORTER_TEST_UNSET"}, wantErr: true},
+		{secret: Secret{Env: "JMX_EXPORTER_TEST_EMPTY"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.secret.Resolve()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Resolve of %+v = %q, %v, want %q, error %v", tt.secret, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestResolvePassword(t *testing.T) {
+	t.Setenv("JMX_EXPORTER_TEST_PASSWORD", "from env")
+	c := &Config{Secrets: map[string]Secret{
+		"cluster1": {Env: "JMX_EXPORTER_TEST_PASSWORD"},
+		"cluster2": {Env: "JMX_EXPORTER_TEST_UNSET"},
+	}}
+
+	tests := []struct {
+		auth    Auth
+		want    string
+		wantErr bool
+	}{
+		{auth: Auth{Password: "inline"}, want: "inline"},
+		{auth: Auth{PasswordEnv: "JMX_EXPORTER_TEST_PASSWORD"}, want: "from env"},
+		{auth: Auth{PasswordEnv: "JMX_EXPORTER_TEST_UNSET"}, wantErr: true},
+		{auth: Auth{PasswordSecret: "cluster1"}, want: "from env"},
+		{auth: Auth{PasswordSecret: "cluster2"}, wantErr: true},
+		{auth: Auth{PasswordSecret: "cluster3"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := c.ResolvePassword(tt.auth)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolvePassword of %+v = %q, %v, want %q, error %v", tt.auth, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	var none *Config
+	if _, err := none.SecretByName("cluster1"); err == nil {
+		t.Error("secret resolved without a config")
+	}
+}
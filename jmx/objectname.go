@@ -0,0 +1,149 @@
+// Package jmx parses and matches the JMX ObjectNames of the beans of /jmx and of the patterns of the
+// qry parameter, collectors and rules
+package jmx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ObjectName is a parsed JMX ObjectName, e.g. Hadoop:service=NameNode,name=FSNamesystem
+type ObjectName struct {
+	Domain string
+	Props  map[string]string
+	// PropertyListPattern is set for patterns ending with ,* which match names with more key properties
+	PropertyListPattern bool
+}
+
+// ParseObjectName parses domain:key=value,key=value, values may be quoted
+func ParseObjectName(s string) (ObjectName, error) {
+	return parseObjectName(s, false)
+}
+
+// ParseObjectNamePattern parses an ObjectName pattern like the qry parameter of /jmx, the domain and
+// the values may contain * and ?, and the key properties may end with * to match any further ones,
+// e.g. Hadoop:service=ResourceManager,name=QueueMetrics,* or java.lang:type=GarbageCollector,name=*
+func ParseObjectNamePattern(s string) (ObjectName, error) {
+	return parseObjectName(s, true)
+}
+
+func parseObjectName(s string, pattern bool) (ObjectName, error) {
+	domain, list, ok := strings.Cut(s, ":")
+	if !ok || domain == "" {
+		return ObjectName{}, fmt.Errorf("invalid ObjectName %q: no domain", s)
+	}
+
+	o := ObjectName{Domain: domain, Props: map[string]string{}}
+	for _, prop := range splitProps(list) {
+		if pattern && prop == "*" {
+			o.PropertyListPattern = true
+			continue
+		}
+		key, value, ok := strings.Cut(prop, "=")
+		if !ok || key == "" {
+			return ObjectName{}, fmt.Errorf("invalid ObjectName %q: bad key property %q", s, prop)
+		}
+		o.Props[key] = value
+	}
+	if len(o.Props) == 0 && !o.PropertyListPattern {
+		return ObjectName{}, fmt.Errorf("invalid ObjectName %q: no key properties", s)
+	}
+
+	return o, nil
+}
+
+// Match reports whether the ObjectName o matches the pattern p
+func (o ObjectName) Match(p ObjectName) bool {
+	if !matchWildcard(p.Domain, o.Domain) {
+		return false
+	}
+	if !p.PropertyListPattern && len(p.Props) != len(o.Props) {
+		return false
+	}
+	for key, pv := range p.Props {
+		v, ok := o.Props[key]
+		if !ok || !matchWildcard(pv, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchWildcard matches s against pattern, * matches any run of characters and ? a single one
+func matchWildcard(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+// splitProps splits a key property list on the commas that are not inside a quoted value
+func splitProps(list string) []string {
+	var props []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				props = append(props, list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(props, list[start:])
+}
+
+// String returns the canonical form of o, the key properties sorted by key like
+// ObjectName.getCanonicalName does, so names that only differ in property order are equal
+func (o ObjectName) String() string {
+	keys := make([]string, 0, len(o.Props))
+	for key := range o.Props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(o.Domain)
+	b.WriteByte(':')
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(o.Props[key])
+	}
+	if o.PropertyListPattern {
+		if len(keys) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('*')
+	}
+	return b.String()
+}
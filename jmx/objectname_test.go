@@ -0,0 +1,90 @@
+package jmx
+
+import "testing"
+
+func TestParseObjectNamePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"Hadoop:service=NameNode,name=FSNamesystem", true},
+		{"Hadoop:service=ResourceManager,name=QueueMetrics,*", true},
+		{"java.lang:type=GarbageCollector,name=*", true},
+		{"*:*", true},
+		{"Hadoop:service", false},
+		{":service=NameNode", false},
+		{"Hadoop", false},
+		{"Hadoop:", false},
+		{"Hadoop:=NameNode", false},
+	}
+	for _, test := range tests {
+		_, err := ParseObjectNamePattern(test.pattern)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseObjectNamePattern(%q): got error %v, want valid %v", test.pattern, err, test.valid)
+		}
+	}
+
+	if _, err := ParseObjectName("Hadoop:service=NameNode,*"); err == nil {
+		t.Error("ParseObjectName accepted the property list pattern ,*")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		match   bool
+	}{
+		{"Hadoop:service=NameNode,name=FSNamesystem", "Hadoop:service=NameNode,name=FSNamesystem", true},
+		{"Hadoop:service=NameNode,name=FSNamesystem", "Hadoop:name=FSNamesystem,service=NameNode", true},
+		{"Hadoop:service=NameNode,name=FSNamesystem", "Hadoop:service=NameNode", false},
+		{"Hadoop:service=NameNode,name=FSNamesystem", "Hadoop:service=NameNode,*", true},
+		{"Hadoop:service=NameNode,name=RpcActivityForPort8020", "Hadoop:service=NameNode,name=RpcActivityForPort*", true},
+		{"Hadoop:service=NameNode,name=RpcActivityForPort8020", "Hadoop:service=NameNode,name=RpcActivityForPort802?", true},
+		{"Hadoop:service=NameNode,name=RpcDetailedActivityForPort8020", "Hadoop:service=NameNode,name=RpcActivityForPort*", false},
+		{"Hadoop:service=DataNode,name=JvmMetrics", "Hadoop:service=*,name=JvmMetrics", true},
+		{"java.lang:type=MemoryPool,name=G1 Eden Space", "java.*:type=MemoryPool,*", true},
+		{"java.nio:type=BufferPool,name=direct", "java.lang:*", false},
+		{"Hadoop:service=HBase,name=RegionServer,sub=Server", "Hadoop:service=HBase,name=RegionServer,*", true},
+	}
+	for _, test := range tests {
+		o, err := ParseObjectName(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := ParseObjectNamePattern(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := o.Match(p); got != test.match {
+			t.Errorf("%q matches %q: got %v, want %v", test.name, test.pattern, got, test.match)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in, canonical string
+	}{
+		{"Hadoop:service=NameNode,name=FSNamesystem", "Hadoop:name=FSNamesystem,service=NameNode"},
+		{"Hadoop:name=FSNamesystem,service=NameNode", "Hadoop:name=FSNamesystem,service=NameNode"},
+		{`metrics:name="a,b",type=x`, `metrics:name="a,b",type=x`},
+	}
+	for _, test := range tests {
+		o, err := ParseObjectName(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := o.String(); got != test.canonical {
+			t.Errorf("String of %q: got %q, want %q", test.in, got, test.canonical)
+		}
+	}
+
+	p, err := ParseObjectNamePattern("java.lang:type=MemoryPool,*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.String(); got != "java.lang:type=MemoryPool,*" {
+		t.Errorf("String of the pattern: got %q", got)
+	}
+}
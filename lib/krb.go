@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,18 +12,41 @@ import (
 	"github.com/prometheus/log"
 
 	"gopkg.in/jcmturner/gokrb5.v7/client"
-	"gopkg.in/jcmturner/gokrb5.v7/config"
 	"gopkg.in/jcmturner/gokrb5.v7/keytab"
 	"gopkg.in/jcmturner/gokrb5.v7/spnego"
 )
 
-func CreateKerberosClientWithPassword(principal string, password string) (*client.Client, error) {
+// ErrKrb5Auth is returned by the MakeKrb5Request functions when the login or the SPNEGO negotiation failed, as opposed to a network error
+var ErrKrb5Auth = errors.New("kerberos authentication failed")
+
+// ErrHTTPStatus is returned by MakeKrb5Request when the response is an error other than 401
+var ErrHTTPStatus = errors.New("unexpected http status")
+
+func CreateKerberosClientWithPassword(principal string, password string, krb5Conf Krb5Config) (*client.Client, error) {
+
+	cli, err := NewKerberosClientWithPassword(principal, password, krb5Conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Log in the client
+	err = cli.Login()
+	if err != nil {
+		return nil, fmt.Errorf("failed to login krb5 client")
+
+	}
+
+	return cli, nil
+}
+
+// NewKerberosClientWithPassword creates the client without logging in
+func NewKerberosClientWithPassword(principal string, password string, krb5Conf Krb5Config, settings ...func(*client.Settings)) (*client.Client, error) {
 
 	// Load the client krb5 config
-	cfg, err := config.Load("/etc/krb5.conf")
+	cfg, err := krb5Conf.Load()
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to load krb5 cfg")
+		return nil, fmt.Errorf("failed to load krb5 cfg: %v", err)
 
 	}
 
@@ -32,7 +57,15 @@ func CreateKerberosClientWithPassword(principal string, password string) (*clien
 
 	}
 
-	cli := client.NewClientWithPassword(username, realm, password, cfg)
+	return client.NewClientWithPassword(username, realm, password, cfg, settings...), nil
+}
+
+func CreateKerberosClientWithKeytab(ktPath string, principal string, krb5Conf Krb5Config) (*client.Client, error) {
+
+	cli, err := NewKerberosClientWithKeytab(ktPath, principal, krb5Conf)
+	if err != nil {
+		return nil, err
+	}
 
 	// Log in the client
 	err = cli.Login()
@@ -44,14 +77,15 @@ func CreateKerberosClientWithPassword(principal string, password string) (*clien
 	return cli, nil
 }
 
-func CreateKerberosClientWithKeytab(ktPath string, principal string) (*client.Client, error) {
+// NewKerberosClientWithKeytab creates the client without logging in
+func NewKerberosClientWithKeytab(ktPath string, principal string, krb5Conf Krb5Config, settings ...func(*client.Settings)) (*client.Client, error) {
 	// https://github.com/jcmturner/gokrb5/blob/855dbc707a37a21467aef6c0245fcf3328dc39ed/USAGE.md?plain=1#L20
 	kt, err := keytab.Load(ktPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load keytab file: %v", err)
 	}
 
-	krb5Conf, err := config.Load("/etc/krb5.conf")
+	cfg, err := krb5Conf.Load()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load Kerberos config: %v", err)
 	}
@@ -62,16 +96,7 @@ func CreateKerberosClientWithKeytab(ktPath string, principal string) (*client.Cl
 		return nil, fmt.Errorf("failed to extract username and realm from principal")
 	}
 
-	cli := client.NewClientWithKeytab(username, realm, kt, krb5Conf)
-
-	// Log in the client
-	err = cli.Login()
-	if err != nil {
-		return nil, fmt.Errorf("failed to login krb5 client")
-
-	}
-
-	return cli, nil
+	return client.NewClientWithKeytab(username, realm, kt, cfg, settings...), nil
 }
 
 func ExtractUsernameAndRealm(principal string) (string, string) {
@@ -93,9 +118,9 @@ func ExtractDomainFromURL(u string) (string, error) {
 	return host, nil
 }
 
-func MakeKrb5Request(client *client.Client, url string) ([]byte, error) {
+func MakeKrb5Request(ctx context.Context, client *client.Client, httpClient *http.Client, url string) ([]byte, error) {
 
-	r, err := http.NewRequest("GET", url, nil)
+	r, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		log.Errorf("could not create request: %v", err)
 		return nil, fmt.Errorf("could not create request: %v", err)
@@ -111,12 +136,19 @@ func MakeKrb5Request(client *client.Client, url string) ([]byte, error) {
 
 	spn := fmt.Sprintf("HTTP/%s", fqdn)
 
-	spnegoCl := spnego.NewClient(client, nil, spn)
+	spnegoCl := spnego.NewClient(client, httpClient, spn)
 
-	err = spnego.SetSPNEGOHeader(client, r, spn)
+	// getting the service ticket may need the KDC, which does not know about ctx
+	err = withContext(ctx, func() error {
+		return spnego.SetSPNEGOHeader(client, r, spn)
+	})
+	if err != nil && ctx.Err() != nil {
+		log.Errorf("timed out getting service ticket: %v", err)
+		return nil, fmt.Errorf("timed out getting service ticket: %v", err)
+	}
 	if err != nil {
 		log.Errorf("error set spnego header: %v", err)
-		return nil, fmt.Errorf("error set spnego header: %v", err)
+		return nil, fmt.Errorf("%w: error set spnego header: %v", ErrKrb5Auth, err)
 	}
 
 	// Make the request
@@ -125,6 +157,18 @@ func MakeKrb5Request(client *client.Client, url string) ([]byte, error) {
 		log.Errorf("error making request: %v", err)
 		return nil, fmt.Errorf("error making request: %v", err)
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		log.Errorf("request unauthorized: %s", resp.Status)
+		return nil, fmt.Errorf("%w: request unauthorized: %s", ErrKrb5Auth, resp.Status)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Errorf("unexpected status: %s", resp.Status)
+		return nil, fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Errorf("error reading response body: %v", err)
@@ -132,34 +176,64 @@ func MakeKrb5Request(client *client.Client, url string) ([]byte, error) {
 	}
 	// fmt.Println(string(body))
 
-	defer resp.Body.Close()
-
 	return body, nil
 
 }
 
-func MakeKrb5RequestWithKeytab(ktPath string, principal string, url string) ([]byte, error) {
+func MakeKrb5RequestWithKeytab(ctx context.Context, ktPath string, principal string, krb5Conf Krb5Config, httpClient *http.Client, url string) ([]byte, error) {
 
-	krb5cli, err := CreateKerberosClientWithKeytab(ktPath, principal)
+	krb5cli, release, err := GetKerberosClientWithKeytab(ctx, ktPath, principal, krb5Conf)
 
 	if err != nil {
 		log.Errorf("could not create krb5 client: %v", err)
-		return nil, fmt.Errorf("could not create krb5 client: %v", err)
+		return nil, fmt.Errorf("%w: could not create krb5 client: %v", ErrKrb5Auth, err)
 	}
+	defer release()
 
-	return MakeKrb5Request(krb5cli, url)
+	return MakeKrb5Request(ctx, krb5cli, httpClient, url)
 
 }
 
-func MakeKrb5RequestWithPassword(principal string, password string, url string) ([]byte, error) {
+func MakeKrb5RequestWithPassword(ctx context.Context, principal string, password string, krb5Conf Krb5Config, httpClient *http.Client, url string) ([]byte, error) {
 
-	krb5cli, err := CreateKerberosClientWithPassword(principal, password)
+	krb5cli, release, err := GetKerberosClientWithPassword(ctx, principal, password, krb5Conf)
 
 	if err != nil {
 		log.Errorf("could not create krb5 client: %v", err)
-		return nil, fmt.Errorf("could not create krb5 client: %v", err)
+		return nil, fmt.Errorf("%w: could not create krb5 client: %v", ErrKrb5Auth, err)
 	}
+	defer release()
 
-	return MakeKrb5Request(krb5cli, url)
+	return MakeKrb5Request(ctx, krb5cli, httpClient, url)
 
 }
+
+func MakeKrb5RequestWithCCache(ctx context.Context, ccachePath string, krb5Conf Krb5Config, httpClient *http.Client, url string) ([]byte, error) {
+
+	krb5cli, release, err := GetKerberosClientWithCCache(ctx, ccachePath, krb5Conf)
+
+	if err != nil {
+		log.Errorf("could not create krb5 client: %v", err)
+		return nil, fmt.Errorf("%w: could not create krb5 client: %v", ErrKrb5Auth, err)
+	}
+	defer release()
+
+	return MakeKrb5Request(ctx, krb5cli, httpClient, url)
+
+}
+
+// withContext runs f and returns early with the error of ctx when ctx is done first, f keeps running
+// in the background until it returns
+func withContext(ctx context.Context, f func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
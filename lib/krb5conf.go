@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/jcmturner/gokrb5.v7/config"
+)
+
+// DefaultKrb5ConfigPath is used when a Krb5Config sets neither a path nor a realm, set by --kerberos.config
+var DefaultKrb5ConfigPath = "/etc/krb5.conf"
+
+// Krb5Config selects the krb5 configuration of a client, either a krb5.conf file or an inline realm definition
+type Krb5Config struct {
+	Path        string
+	Realm       string
+	KDCs        []string
+	DomainRealm map[string]string
+}
+
+func (c Krb5Config) Load() (*config.Config, error) {
+	if c.Realm == "" {
+		path := c.Path
+		if path == "" {
+			path = DefaultKrb5ConfigPath
+		}
+		return config.Load(path)
+	}
+
+	return config.NewConfigFromString(c.String())
+}
+
+// String renders the inline realm definition as a krb5.conf
+func (c Krb5Config) String() string {
+	if c.Realm == "" {
+		path := c.Path
+		if path == "" {
+			path = DefaultKrb5ConfigPath
+		}
+		return path
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "[libdefaults]\n")
+	fmt.Fprintf(&b, "  default_realm = %s\n", c.Realm)
+	fmt.Fprintf(&b, "  dns_lookup_realm = false\n")
+	fmt.Fprintf(&b, "  dns_lookup_kdc = %t\n", len(c.KDCs) == 0)
+
+	fmt.Fprintf(&b, "[realms]\n")
+	fmt.Fprintf(&b, "  %s = {\n", c.Realm)
+	for _, kdc := range c.KDCs {
+		fmt.Fprintf(&b, "    kdc = %s\n", kdc)
+	}
+	fmt.Fprintf(&b, "  }\n")
+
+	// sorted so that the same settings always give the same pool key
+	domains := make([]string, 0, len(c.DomainRealm))
+	for domain := range c.DomainRealm {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	fmt.Fprintf(&b, "[domain_realm]\n")
+	for _, domain := range domains {
+		fmt.Fprintf(&b, "  %s = %s\n", domain, c.DomainRealm[domain])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gopkg.in/jcmturner/gokrb5.v7/client"
+	"gopkg.in/jcmturner/gokrb5.v7/credentials"
+	"gopkg.in/jcmturner/gokrb5.v7/iana/nametype"
+	"gopkg.in/jcmturner/gokrb5.v7/types"
+)
+
+var krbCCacheExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "hadoop_jmx_exporter",
+	Subsystem: "kerberos",
+	Name:      "ccache_expiry_timestamp_seconds",
+	Help:      "Expiry time of the TGT in the credential cache in seconds since epoch",
+}, []string{"path"})
+
+func init() {
+	prometheus.MustRegister(krbCCacheExpiry)
+}
+
+// NewKerberosClientWithCCache creates a client from a credential cache kept fresh by an external
+// kinit or k5start, it returns the expiry of the TGT as the client cannot renew it by itself
+func NewKerberosClientWithCCache(ccachePath string, krb5Conf Krb5Config, settings ...func(*client.Settings)) (*client.Client, time.Time, error) {
+	ccache, err := credentials.LoadCCache(ccachePath)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to load credential cache: %v", err)
+	}
+
+	// the TGT of the default principal is stored under krbtgt/REALM@REALM
+	spn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", ccache.GetClientRealm()},
+	}
+	tgt, ok := ccache.GetEntry(spn)
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("no TGT found in credential cache %s", ccachePath)
+	}
+
+	krbCCacheExpiry.WithLabelValues(ccachePath).Set(float64(tgt.EndTime.Unix()))
+
+	if time.Now().After(tgt.EndTime) {
+		return nil, time.Time{}, fmt.Errorf("TGT in credential cache %s expired at %s", ccachePath, tgt.EndTime.Format(time.RFC3339))
+	}
+
+	cfg, err := krb5Conf.Load()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to load Kerberos config: %v", err)
+	}
+
+	cli, err := client.NewClientFromCCache(ccache, cfg, settings...)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to create krb5 client from credential cache: %v", err)
+	}
+
+	return cli, tgt.EndTime, nil
+}
@@ -0,0 +1,263 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	stdlog "log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/log"
+
+	"gopkg.in/jcmturner/gokrb5.v7/client"
+)
+
+// Kerberos clients are shared by every scrape using the same credentials, so the AS exchange
+// is done once per principal and the TGT and service tickets cached in the client are reused.
+// gokrb5 renews the TGT of a client, or logs in again, when 5/6 of the lifetime of the TGT passed.
+
+var (
+	krbLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "hadoop_jmx_exporter",
+		Subsystem: "kerberos",
+		Name:      "logins_total",
+		Help:      "Total number of Kerberos logins (AS exchanges)",
+	}, []string{"principal"})
+	krbRenewals = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "hadoop_jmx_exporter",
+		Subsystem: "kerberos",
+		Name:      "renewals_total",
+		Help:      "Total number of TGT renewals and logins done by the Kerberos client before the TGT expires",
+	}, []string{"principal"})
+	krbFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "hadoop_jmx_exporter",
+		Subsystem: "kerberos",
+		Name:      "login_failures_total",
+		Help:      "Total number of failed Kerberos logins and renewals",
+	}, []string{"principal"})
+	krbClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "hadoop_jmx_exporter",
+		Subsystem: "kerberos",
+		Name:      "clients",
+		Help:      "Current number of cached Kerberos clients",
+	})
+
+	clientPool = &krbClientPool{clients: map[string]*pooledClient{}}
+)
+
+func init() {
+	prometheus.MustRegister(krbLogins, krbRenewals, krbFailures, krbClients)
+}
+
+type pooledClient struct {
+	mu        sync.Mutex
+	principal string
+	// version changes when the credential file is replaced, the client is then created again
+	version string
+	cli     *client.Client
+	create  func() (*client.Client, time.Time, error)
+	// expiry is set for clients loaded from a credential cache, they cannot log in by themselves
+	expiry time.Time
+
+	// scrapes using the client and whether it was removed from the pool, guarded by the mutex of the
+	// pool. A removed client is destroyed by the last scrape using it
+	users   int
+	removed bool
+}
+
+type krbClientPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+}
+
+// get returns the client stored under key, logging in with create if there is none yet. release
+// must be called once the client is no longer used
+func (p *krbClientPool) get(ctx context.Context, key string, version string, principal string, create func() (*client.Client, time.Time, error)) (*client.Client, func(), error) {
+	p.mu.Lock()
+	pc, ok := p.clients[key]
+	if ok && pc.version != version {
+		p.remove(key)
+		ok = false
+	}
+	if !ok {
+		pc = &pooledClient{principal: principal, version: version, create: create}
+		p.clients[key] = pc
+		krbClients.Set(float64(len(p.clients)))
+	}
+	pc.users++
+	p.mu.Unlock()
+
+	release := func() { p.release(pc) }
+
+	// the login talks to the KDC, which does not know about ctx
+	var cli *client.Client
+	err := withContext(ctx, func() error {
+		var err error
+		cli, err = pc.client()
+		if err != nil {
+			p.invalidate(key, pc)
+		}
+		return err
+	})
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return cli, release, nil
+}
+
+// release ends a use of pc, see get
+func (p *krbClientPool) release(pc *pooledClient) {
+	p.mu.Lock()
+	pc.users--
+	destroy := pc.removed && pc.users == 0
+	p.mu.Unlock()
+
+	if destroy {
+		go pc.destroy()
+	}
+}
+
+// invalidate drops pc if it is still the client stored under key, the next scrape logs in again. Only
+// a failed login invalidates a client, a 401 or a missing service ticket concerns one host
+func (p *krbClientPool) invalidate(key string, pc *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.clients[key] == pc {
+		p.remove(key)
+	}
+}
+
+// remove must be called with p.mu held. A client still used by a scrape is destroyed when it is
+// released. The client is destroyed in the background, it may be logging in, which holds pc.mu
+// while talking to the KDC, and every scrape would wait for it on p.mu
+func (p *krbClientPool) remove(key string) {
+	if pc, ok := p.clients[key]; ok {
+		delete(p.clients, key)
+		krbClients.Set(float64(len(p.clients)))
+
+		pc.removed = true
+		if pc.users == 0 {
+			go pc.destroy()
+		}
+	}
+}
+
+func (pc *pooledClient) destroy() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.cli != nil {
+		pc.cli.Destroy()
+	}
+}
+
+// client returns a logged in client. Clients of a password or a keytab log in once, gokrb5 keeps the
+// TGT valid from its end time. A client of a credential cache cannot log in, it fails once the TGT
+// read from the cache expired and is created again when the cache file changes
+func (pc *pooledClient) client() (*client.Client, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.cli != nil {
+		if !pc.expiry.IsZero() && time.Now().After(pc.expiry) {
+			return nil, fmt.Errorf("kerberos ticket of %s expired at %s", pc.principal, pc.expiry.Format(time.RFC3339))
+		}
+		return pc.cli, nil
+	}
+
+	cli, expiry, err := pc.create()
+	if err != nil {
+		krbFailures.WithLabelValues(pc.principal).Inc()
+		return nil, err
+	}
+
+	// the TGT of a credential cache is already there, there is nothing to log in
+	if expiry.IsZero() {
+		if err := cli.Login(); err != nil {
+			cli.Destroy()
+			krbFailures.WithLabelValues(pc.principal).Inc()
+			return nil, fmt.Errorf("failed to login krb5 client: %v", err)
+		}
+		krbLogins.WithLabelValues(pc.principal).Inc()
+		log.Debugf("logged in krb5 client of %s", pc.principal)
+	}
+
+	pc.cli = cli
+	pc.expiry = expiry
+	return pc.cli, nil
+}
+
+// sessionEvents counts the TGT renewals of a client, gokrb5 does them in the background and only
+// tells its logger about them
+type sessionEvents struct {
+	principal string
+}
+
+func (e sessionEvents) Write(p []byte) (int, error) {
+	switch {
+	case bytes.Contains(p, []byte("refreshing TGT session")):
+		krbRenewals.WithLabelValues(e.principal).Inc()
+	case bytes.Contains(p, []byte("error refreshing session")):
+		krbFailures.WithLabelValues(e.principal).Inc()
+	}
+	return len(p), nil
+}
+
+// sessionLogger is the gokrb5 logger of the clients of the pool, see sessionEvents
+func sessionLogger(principal string) func(*client.Settings) {
+	return client.Logger(stdlog.New(sessionEvents{principal: principal}, "", 0))
+}
+
+func passwordClientKey(principal string, password string, krb5Conf Krb5Config) string {
+	sum := sha256.Sum256([]byte(password))
+	return "password:" + principal + ":" + hex.EncodeToString(sum[:]) + ":" + krb5Conf.String()
+}
+
+func keytabClientKey(ktPath string, principal string, krb5Conf Krb5Config) string {
+	return "keytab:" + principal + ":" + ktPath + ":" + krb5Conf.String()
+}
+
+func ccacheClientKey(ccachePath string, krb5Conf Krb5Config) string {
+	return "ccache:" + ccachePath + ":" + krb5Conf.String()
+}
+
+// fileVersion is the modification time of a credential file, so a replaced keytab or a refreshed
+// credential cache is loaded again
+func fileVersion(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return info.ModTime().String()
+}
+
+// GetKerberosClientWithPassword returns the pooled client of principal, release must be called once
+// the client is no longer used
+func GetKerberosClientWithPassword(ctx context.Context, principal string, password string, krb5Conf Krb5Config) (*client.Client, func(), error) {
+	return clientPool.get(ctx, passwordClientKey(principal, password, krb5Conf), "", principal, func() (*client.Client, time.Time, error) {
+		cli, err := NewKerberosClientWithPassword(principal, password, krb5Conf, sessionLogger(principal))
+		return cli, time.Time{}, err
+	})
+}
+
+// GetKerberosClientWithKeytab is GetKerberosClientWithPassword for a keytab
+func GetKerberosClientWithKeytab(ctx context.Context, ktPath string, principal string, krb5Conf Krb5Config) (*client.Client, func(), error) {
+	return clientPool.get(ctx, keytabClientKey(ktPath, principal, krb5Conf), fileVersion(ktPath), principal, func() (*client.Client, time.Time, error) {
+		cli, err := NewKerberosClientWithKeytab(ktPath, principal, krb5Conf, sessionLogger(principal))
+		return cli, time.Time{}, err
+	})
+}
+
+// GetKerberosClientWithCCache is GetKerberosClientWithPassword for a credential cache
+func GetKerberosClientWithCCache(ctx context.Context, ccachePath string, krb5Conf Krb5Config) (*client.Client, func(), error) {
+	return clientPool.get(ctx, ccacheClientKey(ccachePath, krb5Conf), fileVersion(ccachePath), ccachePath, func() (*client.Client, time.Time, error) {
+		return NewKerberosClientWithCCache(ccachePath, krb5Conf, sessionLogger(ccachePath))
+	})
+}
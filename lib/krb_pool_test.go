@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopkg.in/jcmturner/gokrb5.v7/client"
+	"gopkg.in/jcmturner/gokrb5.v7/config"
+)
+
+// newTestClient returns a client that needs no KDC, like one of a credential cache
+func newTestClient() (*client.Client, time.Time, error) {
+	return client.NewClientWithPassword("hdfs", "EXAMPLE.COM", "secret", config.NewConfig()), time.Now().Add(time.Hour), nil
+}
+
+// destroyed waits for the background destroy of pc, the destroyed client has no credentials
+func destroyed(pc *pooledClient) bool {
+	for i := 0; i < 20; i++ {
+		pc.mu.Lock()
+		done := pc.cli.Credentials.UserName() == ""
+		pc.mu.Unlock()
+		if done {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestKrbClientPoolReleasesReplacedClient(t *testing.T) {
+	p := &krbClientPool{clients: map[string]*pooledClient{}}
+	ctx := context.Background()
+
+	old, release, err := p.get(ctx, "key", "v1", "hdfs", newTestClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPc := p.clients["key"]
+
+	// the credential file changed while a scrape still uses the old client
+	cli, releaseNew, err := p.get(ctx, "key", "v2", "hdfs", newTestClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cli == old {
+		t.Fatal("client not created again for a new version")
+	}
+	if destroyed(oldPc) {
+		t.Fatal("client destroyed while it is still used")
+	}
+
+	release()
+	if !destroyed(oldPc) {
+		t.Error("replaced client not destroyed after its last use")
+	}
+
+	releaseNew()
+	if destroyed(p.clients["key"]) {
+		t.Error("client of the pool destroyed after its use")
+	}
+}
+
+func TestKrbClientPoolExpiredTicket(t *testing.T) {
+	p := &krbClientPool{clients: map[string]*pooledClient{}}
+	expired := func() (*client.Client, time.Time, error) {
+		cli, _, err := newTestClient()
+		return cli, time.Now().Add(-time.Minute), err
+	}
+
+	// the first use returns the client, the expiry is only checked when it is reused
+	_, release, err := p.get(context.Background(), "key", "v1", "hdfs", expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := p.clients["key"]
+	release()
+
+	if _, _, err := p.get(context.Background(), "key", "v1", "hdfs", expired); err == nil {
+		t.Fatal("expired ticket returned")
+	}
+	if _, ok := p.clients["key"]; ok {
+		t.Error("client with an expired ticket kept in the pool")
+	}
+	if !destroyed(pc) {
+		t.Error("client with an expired ticket not destroyed")
+	}
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"hadoop_jmx_exporter/collector"
+	"hadoop_jmx_exporter/config"
+	"hadoop_jmx_exporter/lib"
+	"html"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
 	webflag "github.com/prometheus/exporter-toolkit/web/kingpinflag"
@@ -21,9 +27,16 @@ import (
 
 var (
 	// Version will be set at build time.
-	Version      = "0.0.0.dev"
-	scrapePath   = kingpin.Flag("web.scrape-path", "Path under which to expose metrics. (env: TELEMETRY_PATH)").Default(getEnv("TELEMETRY_PATH", "/scrape")).String()
-	toolkitFlags = webflag.AddFlags(kingpin.CommandLine, ":9070")
+	Version                = "0.0.0.dev"
+	configFile             = kingpin.Flag("config.file", "Hadoop jmx exporter configuration file.").Default("").String()
+	krb5Config             = kingpin.Flag("kerberos.config", "Path to the default krb5.conf. (env: KRB5_CONFIG)").Default(getEnv("KRB5_CONFIG", "/etc/krb5.conf")).String()
+	scrapePath             = kingpin.Flag("web.scrape-path", "Path under which to expose metrics. (env: TELEMETRY_PATH)").Default(getEnv("TELEMETRY_PATH", "/scrape")).String()
+	allowInlineCredentials = kingpin.Flag("allow-inline-credentials", "Allow the Kerberos password to be passed in the password query parameter.").Default("false").Bool()
+	scrapeTimeout          = kingpin.Flag("scrape.timeout", "Timeout of a scrape when Prometheus does not send X-Prometheus-Scrape-Timeout-Seconds.").Default("10s").Duration()
+	scrapeTimeoutOffset    = kingpin.Flag("scrape.timeout-offset", "Offset to subtract from the Prometheus scrape timeout, leaves time to send the response.").Default("0.5s").Duration()
+	detectionCacheTTL      = kingpin.Flag("detection.cache-ttl", "How long the detected collector and JMX capabilities of a target are reused, 0 detects on every scrape.").Default("10m").Duration()
+	legacyGaugeNames       = kingpin.Flag("compat.legacy-gauge-names", "Export cumulative JMX values as gauges with the names before they became counters ending in _total.").Default("false").Bool()
+	toolkitFlags           = webflag.AddFlags(kingpin.CommandLine, ":9070")
 )
 
 func main() {
@@ -39,11 +52,50 @@ func main() {
 	level.Info(logger).Log("msg", "Starting hadoop_jmx_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", "build", version.BuildContext())
 
-	http.HandleFunc("/scrape", scrapeHandle(logger))
+	lib.DefaultKrb5ConfigPath = *krb5Config
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("<html><head><title>Hadoop Jmx Exporter " + Version + "</title></head><body><h1>Hadoop Jmx Exporter " + Version + "</h1><p><a href='" + *scrapePath + "'>Scrape</a></p></body></html>"))
-	})
+	settings := collector.Settings{
+		AllowInlineCredentials: *allowInlineCredentials,
+		ScrapeTimeout:          *scrapeTimeout,
+		ScrapeTimeoutOffset:    *scrapeTimeoutOffset,
+		DetectionCacheTTL:      *detectionCacheTTL,
+		LegacyGaugeNames:       *legacyGaugeNames,
+	}
+
+	if err := collector.ValidateCollectors(logger, settings); err != nil {
+		level.Error(logger).Log("msg", "Invalid collectors", "err", err)
+		os.Exit(1)
+	}
+
+	conf := &config.Config{}
+	if *configFile != "" {
+		var err error
+		conf, err = config.LoadFile(*configFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error loading config", "file", *configFile, "err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "Loaded config file", "file", *configFile, "modules", len(conf.Modules))
+	}
+
+	http.HandleFunc(*scrapePath, scrapeHandle(logger, conf, settings))
+	// the path of the blackbox exporter, so probe configs work with only the address changed
+	if *scrapePath != "/probe" {
+		http.HandleFunc("/probe", scrapeHandle(logger, conf, settings))
+	}
+	// metrics of the exporter itself, e.g. Kerberos logins
+	if *scrapePath != "/metrics" {
+		http.Handle("/metrics", promhttp.Handler())
+	}
+
+	if *scrapePath != "/" {
+		landingPage, err := landingPages(conf)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error creating landing page", "err", err)
+			os.Exit(1)
+		}
+		http.Handle("/", landingPage)
+	}
 
 	server := &http.Server{}
 	if err := web.ListenAndServe(server, toolkitFlags, logger); err != nil {
@@ -52,13 +104,74 @@ func main() {
 	}
 }
 
-func scrapeHandle(logger log.Logger) func(w http.ResponseWriter, r *http.Request) {
+func scrapeHandle(logger log.Logger, conf *config.Config, settings collector.Settings) func(w http.ResponseWriter, r *http.Request) {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		collector.Handler(w, r, logger)
+		collector.Handler(w, r, logger, conf, settings)
+
+	}
+}
+
+// landingPages returns the landing page, /?module=<name> shows the form with the module filled in
+func landingPages(conf *config.Config) (http.Handler, error) {
+	names := make([]string, 0, len(conf.Modules))
+	for name := range conf.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pages := map[string]*web.LandingPageHandler{}
+	for _, module := range append([]string{""}, names...) {
+		page, err := web.NewLandingPage(landingConfig(conf, names, module))
+		if err != nil {
+			return nil, err
+		}
+		pages[module] = page
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Query().Get("module")]
+		if !ok {
+			page = pages[""]
+		}
+		page.ServeHTTP(w, r)
+	}), nil
+}
+
+// landingConfig returns the landing page with a form to scrape a target and a link for each module,
+// a module needs a target so the link opens the form with the module filled in. The page is a text
+// template, the names of the modules are escaped here
+func landingConfig(conf *config.Config, names []string, module string) web.LandingConfig {
+	landing := web.LandingConfig{
+		Name:        "Hadoop JMX Exporter",
+		Description: "Prometheus exporter for the JMX metrics of Hadoop, HBase and Hive",
+		Version:     version.Info(),
+		Form: web.LandingForm{
+			Action: *scrapePath,
+			Inputs: []web.LandingFormInput{
+				{Label: "Target", Type: "text", Name: "target", Placeholder: "http://namenode:9870/jmx"},
+				{Label: "Module", Type: "text", Name: "module", Placeholder: "module", Value: html.EscapeString(module)},
+			},
+		},
+	}
+	if *scrapePath != "/metrics" {
+		landing.Links = append(landing.Links, web.LandingLinks{
+			Address: "/metrics", Text: "Metrics", Description: "Metrics of the exporter itself",
+		})
+	}
 
+	for _, name := range names {
+		module := conf.Modules[name]
+		description := "Module, collectors detected"
+		if module.Collector != "" {
+			description = "Module, collectors " + module.Collector
+		}
+		description += ", auth " + module.Auth.AuthMode()
+		landing.Links = append(landing.Links, web.LandingLinks{
+			Address: "/?module=" + url.QueryEscape(name), Text: html.EscapeString(name), Description: html.EscapeString(description),
+		})
 	}
+	return landing
 }
 
 // getEnv returns the value of an environment variable, or returns the provided fallback value